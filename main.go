@@ -22,6 +22,8 @@ import (
 
 var (
 	configFile = kingpin.Flag("config", "Configuration File").Default("config.yml").Short('c').String()
+	exportZone = kingpin.Flag("export-zone", "Write zone file of this zone to output after loading entries and exit").String()
+	exportFile = kingpin.Flag("export-output", "File where zone file is written when exporting a zone").Default("-").String()
 )
 
 var (
@@ -63,6 +65,9 @@ func main() {
 		nClient,
 		cnf.Workers.NbWorkers,
 		time.Duration(cnf.Workers.RefreshInterval),
+		cnf.Workers.CacheFile,
+		cnf.Netdisco.LookupCache,
+		cnf.DNSServer,
 	)
 
 	ctx, cancelResolver := context.WithCancel(context.Background())
@@ -75,6 +80,11 @@ func main() {
 		domainsMetrics = append(domainsMetrics, e.Domain)
 	}
 	prometheus.MustRegister(metrics.NewDeviceCollectors(resolver, domainsMetrics))
+	prometheus.MustRegister(metrics.NewEntryCollectors(resolver))
+
+	dnsCollectors := metrics.NewDNSCollectors()
+	resolver.AddDNSObserver(dnsCollectors)
+	prometheus.MustRegister(dnsCollectors)
 
 	if !cnf.DisableReportsMetrics {
 		prometheus.MustRegister(metrics.NewReportsCollectors(nClient))
@@ -87,6 +97,16 @@ func main() {
 
 	resolver.WaitWarmup()
 
+	if *exportZone != "" {
+		err = exportZoneFile(resolver, *exportZone, *exportFile)
+		cancelResolver()
+		resolver.Close()
+		if err != nil {
+			logrus.Fatal(err.Error())
+		}
+		return
+	}
+
 	toWait := 2
 	if cnf.HTTPServer.Disable {
 		toWait--
@@ -125,4 +145,33 @@ func main() {
 	if toWait > 0 {
 		wg.Wait()
 	}
+	resolver.Close()
+}
+
+// exportZoneFile write zone file of a zone served to a file, "-" means stdout.
+// Zone is only written when all entries have been refreshed from netdisco to never export stale devices
+func exportZoneFile(resolver *services.Resolver, zoneName string, output string) error {
+	zone := resolver.Zone(zoneName)
+	if zone == nil {
+		return fmt.Errorf("zone %s is not set in dns server zones", zoneName)
+	}
+	resolver.WaitRefresh()
+	for _, status := range resolver.EntriesStatus() {
+		if status.Stale {
+			return fmt.Errorf("entry %s could not be refreshed from netdisco: %s", status.Domain, status.LastError)
+		}
+	}
+	if output == "-" {
+		return resolver.WriteZoneFile(os.Stdout, zone)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	err = resolver.WriteZoneFile(f, zone)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
 }
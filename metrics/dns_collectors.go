@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/services"
+)
+
+// DNSCollectors collect dns server activity, it is set as observer on resolver
+type DNSCollectors struct {
+	queries            *prometheus.CounterVec
+	responseSize       *prometheus.HistogramVec
+	duration           *prometheus.HistogramVec
+	truncatedResponses *prometheus.CounterVec
+	queriesDropped     *prometheus.CounterVec
+	forwardedQueries   prometheus.Counter
+	upstreamFailures   *prometheus.CounterVec
+}
+
+func NewDNSCollectors() *DNSCollectors {
+	return &DNSCollectors{
+		queries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "netdisco",
+				Subsystem: "dns",
+				Name:      "queries_total",
+				Help:      "Number of dns queries answered, entry is empty for names outside entries.",
+			},
+			[]string{"transport", "qtype", "rcode", "entry"},
+		),
+		responseSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "netdisco",
+				Subsystem: "dns",
+				Name:      "response_size_bytes",
+				Help:      "Size of dns responses.",
+				Buckets:   prometheus.ExponentialBuckets(64, 2, 11),
+			},
+			[]string{"transport"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "netdisco",
+				Subsystem: "dns",
+				Name:      "request_duration_seconds",
+				Help:      "Time taken to answer dns queries.",
+				Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+			},
+			[]string{"transport"},
+		),
+		truncatedResponses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "netdisco",
+				Subsystem: "dns",
+				Name:      "truncated_responses_total",
+				Help:      "Number of dns responses sent with truncated flag.",
+			},
+			[]string{"transport"},
+		),
+		queriesDropped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "netdisco",
+				Subsystem: "dns",
+				Name:      "queries_dropped_total",
+				Help:      "Number of dns queries refused by access control or rate limits.",
+			},
+			[]string{"reason"},
+		),
+		forwardedQueries: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "netdisco",
+				Subsystem: "dns",
+				Name:      "forwarded_queries_total",
+				Help:      "Number of dns queries forwarded to upstreams.",
+			},
+		),
+		upstreamFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "netdisco",
+				Subsystem: "dns",
+				Name:      "upstream_failures_total",
+				Help:      "Number of forwarded queries which failed on upstream, next upstream is tried if any.",
+			},
+			[]string{"upstream"},
+		),
+	}
+}
+
+func (c *DNSCollectors) QueryServed(info *services.QueryInfo) {
+	qtype := ""
+	if len(info.Request.Question) > 0 {
+		qtype = dnsTypeString(info.Request.Question[0].Qtype)
+	}
+	rcode, ok := dns.RcodeToString[info.Response.Rcode]
+	if !ok {
+		rcode = strconv.Itoa(info.Response.Rcode)
+	}
+	c.queries.WithLabelValues(info.Transport, qtype, rcode, info.EntryDomain).Inc()
+	c.responseSize.WithLabelValues(info.Transport).Observe(float64(info.ResponseSize))
+	c.duration.WithLabelValues(info.Transport).Observe(info.Duration.Seconds())
+	if info.Response.Truncated {
+		c.truncatedResponses.WithLabelValues(info.Transport).Inc()
+	}
+}
+
+func (c *DNSCollectors) QueryDropped(reason string) {
+	c.queriesDropped.WithLabelValues(reason).Inc()
+}
+
+func (c *DNSCollectors) QueryForwarded() {
+	c.forwardedQueries.Inc()
+}
+
+func (c *DNSCollectors) UpstreamFailure(upstream string) {
+	c.upstreamFailures.WithLabelValues(upstream).Inc()
+}
+
+func (c *DNSCollectors) Describe(ch chan<- *prometheus.Desc) {
+	c.queries.Describe(ch)
+	c.responseSize.Describe(ch)
+	c.duration.Describe(ch)
+	c.truncatedResponses.Describe(ch)
+	c.queriesDropped.Describe(ch)
+	c.forwardedQueries.Describe(ch)
+	c.upstreamFailures.Describe(ch)
+}
+
+func (c *DNSCollectors) Collect(ch chan<- prometheus.Metric) {
+	c.queries.Collect(ch)
+	c.responseSize.Collect(ch)
+	c.duration.Collect(ch)
+	c.truncatedResponses.Collect(ch)
+	c.queriesDropped.Collect(ch)
+	c.forwardedQueries.Collect(ch)
+	c.upstreamFailures.Collect(ch)
+}
+
+// dnsTypeString give name of dns type, unknown types are given as OTHER to not make a label per value
+func dnsTypeString(qtype uint16) string {
+	if s, ok := dns.TypeToString[qtype]; ok {
+		return s
+	}
+	return "OTHER"
+}
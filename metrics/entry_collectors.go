@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/services"
+)
+
+// EntryCollectors collect refresh status of entries loaded from netdisco
+type EntryCollectors struct {
+	resolver *services.Resolver
+
+	lastAttempt     *prometheus.GaugeVec
+	lastSuccess     *prometheus.GaugeVec
+	refreshDuration *prometheus.GaugeVec
+	devices         *prometheus.GaugeVec
+	stale           *prometheus.GaugeVec
+}
+
+func NewEntryCollectors(resolver *services.Resolver) *EntryCollectors {
+	return &EntryCollectors{
+		resolver: resolver,
+		lastAttempt: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netdisco",
+				Subsystem: "entry",
+				Name:      "last_refresh_attempt_timestamp_seconds",
+				Help:      "Time of last attempt to refresh entry from netdisco, 0 if never attempted.",
+			},
+			[]string{"domain"},
+		),
+		lastSuccess: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netdisco",
+				Subsystem: "entry",
+				Name:      "last_refresh_success_timestamp_seconds",
+				Help:      "Time of last successful refresh of entry from netdisco, 0 if never succeeded.",
+			},
+			[]string{"domain"},
+		),
+		refreshDuration: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netdisco",
+				Subsystem: "entry",
+				Name:      "refresh_duration_seconds",
+				Help:      "Time taken by last attempt to refresh entry from netdisco.",
+			},
+			[]string{"domain"},
+		),
+		devices: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netdisco",
+				Subsystem: "entry",
+				Name:      "devices",
+				Help:      "Number of devices retrieved by last successful refresh of entry.",
+			},
+			[]string{"domain"},
+		),
+		stale: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netdisco",
+				Subsystem: "entry",
+				Name:      "stale",
+				Help:      "Set to 1 when devices of entry were not retrieved by last refresh attempt.",
+			},
+			[]string{"domain"},
+		),
+	}
+}
+
+func (c *EntryCollectors) Describe(ch chan<- *prometheus.Desc) {
+	c.lastAttempt.Describe(ch)
+	c.lastSuccess.Describe(ch)
+	c.refreshDuration.Describe(ch)
+	c.devices.Describe(ch)
+	c.stale.Describe(ch)
+}
+
+func (c *EntryCollectors) Collect(ch chan<- prometheus.Metric) {
+	for _, status := range c.resolver.EntriesStatus() {
+		lastAttempt := 0.0
+		if status.LastAttempt != nil {
+			lastAttempt = float64(status.LastAttempt.UnixNano()) / 1e9
+		}
+		lastSuccess := 0.0
+		if status.LastSuccess != nil {
+			lastSuccess = float64(status.LastSuccess.UnixNano()) / 1e9
+		}
+		stale := 0.0
+		if status.Stale {
+			stale = 1
+		}
+		c.lastAttempt.WithLabelValues(status.Domain).Set(lastAttempt)
+		c.lastSuccess.WithLabelValues(status.Domain).Set(lastSuccess)
+		c.refreshDuration.WithLabelValues(status.Domain).Set(status.RefreshDuration)
+		c.devices.WithLabelValues(status.Domain).Set(float64(status.DeviceCount))
+		c.stale.WithLabelValues(status.Domain).Set(stale)
+	}
+	c.lastAttempt.Collect(ch)
+	c.lastSuccess.Collect(ch)
+	c.refreshDuration.Collect(ch)
+	c.devices.Collect(ch)
+	c.stale.Collect(ch)
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CIDRs is a list of networks which can be set in config as ip or cidr,
+// e.g.: [ 10.0.0.1, 192.168.0.0/16, 2001:db8::/32 ]
+type CIDRs []*net.IPNet
+
+func (c *CIDRs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw []string
+	err := unmarshal(&raw)
+	if err != nil {
+		return err
+	}
+	cidrs := make(CIDRs, 0, len(raw))
+	for _, r := range raw {
+		if !strings.Contains(r, "/") {
+			ip := net.ParseIP(r)
+			if ip == nil {
+				return fmt.Errorf("invalid ip '%s'", r)
+			}
+			if ip.To4() != nil {
+				r += "/32"
+			} else {
+				r += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return err
+		}
+		cidrs = append(cidrs, ipNet)
+	}
+	*c = cidrs
+	return nil
+}
+
+func (c CIDRs) Contains(ip net.IP) bool {
+	for _, ipNet := range c {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,16 +4,214 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"net"
+	"os"
 	"time"
 
+	"github.com/miekg/dns"
 	pmodel "github.com/prometheus/common/model"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
 type DNSServerConfig struct {
-	Disable bool   `yaml:"disable"`
-	Listen  string `yaml:"listen"`
+	Disable    bool               `yaml:"disable"`
+	Listen     string             `yaml:"listen"`
+	Zones      []*DNSZone         `yaml:"zones"`
+	MaxUDPSize uint16             `yaml:"max_udp_size"`
+	Forwarder  *Forwarder         `yaml:"forwarder"`
+	Transfer   *Transfer          `yaml:"transfer"`
+	DoT        *DoTConfig         `yaml:"dot"`
+	Views      Views              `yaml:"views"`
+	ACL        *AccessControl     `yaml:"acl"`
+	RateLimit  *RateLimit         `yaml:"rate_limit"`
+	RRL        *ResponseRateLimit `yaml:"rrl"`
+	QueryLog   bool               `yaml:"query_log"`
+	DNSTap     *DNSTapConfig      `yaml:"dnstap"`
+}
+
+// DNSTapConfig set where dnstap messages of queries and responses are written, to a unix socket or to a file
+type DNSTapConfig struct {
+	Enable     bool   `yaml:"enable"`
+	Socket     string `yaml:"socket"`
+	File       string `yaml:"file"`
+	Identity   string `yaml:"identity"`
+	Version    string `yaml:"version"`
+	BufferSize int    `yaml:"buffer_size"`
+}
+
+func (c *DNSTapConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain DNSTapConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if !c.Enable {
+		return nil
+	}
+	if (c.Socket == "") == (c.File == "") {
+		return fmt.Errorf("dnstap must have either a socket or a file")
+	}
+	if c.Identity == "" {
+		c.Identity, _ = os.Hostname()
+	}
+	if c.Version == "" {
+		c.Version = "netdisco-bridges"
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = 10000
+	}
+	return nil
+}
+
+// AccessControl give clients allowed to query dns server, deny list take precedence over allow list
+// and everybody not denied is allowed when allow list is empty
+type AccessControl struct {
+	Allow CIDRs `yaml:"allow"`
+	Deny  CIDRs `yaml:"deny"`
+}
+
+func (c *AccessControl) Allowed(ip net.IP) bool {
+	if c == nil {
+		return true
+	}
+	if ip == nil {
+		return len(c.Allow) == 0
+	}
+	if c.Deny.Contains(ip) {
+		return false
+	}
+	return len(c.Allow) == 0 || c.Allow.Contains(ip)
+}
+
+// RateLimit limit number of queries for each client ip
+type RateLimit struct {
+	QueriesPerSecond float64 `yaml:"queries_per_second"`
+	Burst            int     `yaml:"burst"`
+	Exempt           CIDRs   `yaml:"exempt"`
+}
+
+func (c *RateLimit) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain RateLimit
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if c.QueriesPerSecond < 0 {
+		return fmt.Errorf("queries_per_second must be positive")
+	}
+	if c.Burst <= 0 {
+		c.Burst = int(math.Ceil(c.QueriesPerSecond))
+	}
+	return nil
+}
+
+// ResponseRateLimit limit number of identical responses sent to a client network,
+// responses are identical when they have same name, type and rcode
+type ResponseRateLimit struct {
+	ResponsesPerSecond float64 `yaml:"responses_per_second"`
+	Burst              int     `yaml:"burst"`
+	IPv4PrefixLength   int     `yaml:"ipv4_prefix_length"`
+	IPv6PrefixLength   int     `yaml:"ipv6_prefix_length"`
+	Exempt             CIDRs   `yaml:"exempt"`
+}
+
+func (c *ResponseRateLimit) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ResponseRateLimit
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if c.ResponsesPerSecond < 0 {
+		return fmt.Errorf("responses_per_second must be positive")
+	}
+	if c.Burst <= 0 {
+		c.Burst = int(math.Ceil(c.ResponsesPerSecond))
+	}
+	if c.IPv4PrefixLength == 0 {
+		c.IPv4PrefixLength = 24
+	}
+	if c.IPv6PrefixLength == 0 {
+		c.IPv6PrefixLength = 56
+	}
+	if c.IPv4PrefixLength < 0 || c.IPv4PrefixLength > 32 {
+		return fmt.Errorf("ipv4_prefix_length must be between 1 and 32")
+	}
+	if c.IPv6PrefixLength < 0 || c.IPv6PrefixLength > 128 {
+		return fmt.Errorf("ipv6_prefix_length must be between 1 and 128")
+	}
+	return nil
+}
+
+type DoTConfig struct {
+	Enable bool   `yaml:"enable"`
+	Listen string `yaml:"listen"`
+	TLSPem TLSPem `yaml:"tls_pem"`
+}
+
+func (c *DoTConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain DoTConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if !c.Enable {
+		return nil
+	}
+	if c.Listen == "" {
+		c.Listen = "0.0.0.0:853"
+	}
+	return nil
+}
+
+type Transfer struct {
+	Allow  CIDRs    `yaml:"allow"`
+	Notify []string `yaml:"notify"`
+}
+
+func (c *Transfer) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Transfer
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	for i, secondary := range c.Notify {
+		if _, _, err := net.SplitHostPort(secondary); err != nil {
+			c.Notify[i] = net.JoinHostPort(secondary, "53")
+		}
+	}
+	return nil
+}
+
+type Forwarder struct {
+	Enable           bool            `yaml:"enable"`
+	Upstreams        []string        `yaml:"upstreams"`
+	Timeout          pmodel.Duration `yaml:"timeout"`
+	NetdiscoSuffixes []string        `yaml:"netdisco_suffixes"`
+}
+
+func (c *Forwarder) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Forwarder
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if !c.Enable {
+		return nil
+	}
+	if len(c.Upstreams) == 0 {
+		return fmt.Errorf("at least one upstream must be set when forwarder is enabled")
+	}
+	for i, upstream := range c.Upstreams {
+		if _, _, err := net.SplitHostPort(upstream); err != nil {
+			c.Upstreams[i] = net.JoinHostPort(upstream, "53")
+		}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = pmodel.Duration(2 * time.Second)
+	}
+	return nil
 }
 
 func (c *DNSServerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -22,6 +220,13 @@ func (c *DNSServerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	if err != nil {
 		return err
 	}
+	// max udp size is also used by dns over https
+	if c.MaxUDPSize == 0 {
+		c.MaxUDPSize = 1232
+	}
+	if c.MaxUDPSize < dns.MinMsgSize {
+		return fmt.Errorf("max_udp_size must be at least %d", dns.MinMsgSize)
+	}
 	if c.Disable {
 		return nil
 	}
@@ -50,12 +255,16 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if len(c.Entries) == 0 {
 		return fmt.Errorf("you must set at least one entry")
 	}
+	if err := c.Entries.Validate(); err != nil {
+		return err
+	}
 	if c.Netdisco == nil {
 		return fmt.Errorf("netdisco config must be set")
 	}
 	if c.DNSServer == nil {
 		c.DNSServer = &DNSServerConfig{
-			Listen: "0.0.0.0:53",
+			Listen:     "0.0.0.0:53",
+			MaxUDPSize: 1232,
 		}
 	}
 	if c.HTTPServer == nil {
@@ -101,6 +310,7 @@ func (c *HTTPServerConfig) UnmarshalYAML(unmarshal func(interface{}) error) erro
 type WorkersConfig struct {
 	NbWorkers       int             `yaml:"nb_workers"`
 	RefreshInterval pmodel.Duration `yaml:"refresh_interval"`
+	CacheFile       string          `yaml:"cache_file"`
 }
 
 func (c *WorkersConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -119,11 +329,33 @@ func (c *WorkersConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 }
 
 type NetdiscoConfig struct {
-	Endpoint           string `yaml:"endpoint"`
-	Username           string `yaml:"username"`
-	Password           string `yaml:"password"`
-	ApiKey             string `yaml:"api_key"`
-	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	Endpoint           string             `yaml:"endpoint"`
+	Username           string             `yaml:"username"`
+	Password           string             `yaml:"password"`
+	ApiKey             string             `yaml:"api_key"`
+	InsecureSkipVerify bool               `yaml:"insecure_skip_verify"`
+	LookupCache        *LookupCacheConfig `yaml:"lookup_cache"`
+}
+
+// LookupCacheConfig set cache of devices searched in netdisco for names which are not in entries
+type LookupCacheConfig struct {
+	MaxEntries  int             `yaml:"max_entries"`
+	NegativeTTL pmodel.Duration `yaml:"negative_ttl"`
+}
+
+func (c *LookupCacheConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain LookupCacheConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 10000
+	}
+	if c.NegativeTTL <= 0 {
+		c.NegativeTTL = pmodel.Duration(time.Minute)
+	}
+	return nil
 }
 
 func (c *NetdiscoConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -135,6 +367,12 @@ func (c *NetdiscoConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	if c.Endpoint == "" {
 		return fmt.Errorf("endpoint to netdisco must be set")
 	}
+	if c.LookupCache == nil {
+		c.LookupCache = &LookupCacheConfig{
+			MaxEntries:  10000,
+			NegativeTTL: pmodel.Duration(time.Minute),
+		}
+	}
 
 	return nil
 }
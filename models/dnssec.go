@@ -0,0 +1,94 @@
+package models
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	pmodel "github.com/prometheus/common/model"
+)
+
+// DNSSECConfig give keys used to sign a zone online,
+// keys are set by path of bind key files without extension, e.g.: /keys/Kexample.com.+013+12345
+type DNSSECConfig struct {
+	Keys              []string        `yaml:"keys" json:"keys"`
+	SignatureValidity pmodel.Duration `yaml:"signature_validity" json:"signature_validity"`
+
+	signingKeys []*DNSSECKey
+}
+
+// DNSSECKey is a dnskey with its private key, key with SEP flag is a KSK or a CSK when zone has no ZSK
+type DNSSECKey struct {
+	DNSKEY *dns.DNSKEY
+	Signer crypto.Signer
+}
+
+func (k *DNSSECKey) IsKSK() bool {
+	return k.DNSKEY.Flags&dns.SEP == dns.SEP
+}
+
+func (c *DNSSECConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain DNSSECConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if len(c.Keys) == 0 {
+		return fmt.Errorf("at least one key must be set for dnssec")
+	}
+	if c.SignatureValidity <= 0 {
+		c.SignatureValidity = pmodel.Duration(7 * 24 * time.Hour)
+	}
+	c.signingKeys = make([]*DNSSECKey, 0, len(c.Keys))
+	for _, keyPath := range c.Keys {
+		key, err := loadDNSSECKey(keyPath)
+		if err != nil {
+			return err
+		}
+		c.signingKeys = append(c.signingKeys, key)
+	}
+	return nil
+}
+
+// SigningKeys give keys loaded from files
+func (c *DNSSECConfig) SigningKeys() []*DNSSECKey {
+	return c.signingKeys
+}
+
+func loadDNSSECKey(keyPath string) (*DNSSECKey, error) {
+	keyPath = strings.TrimSuffix(strings.TrimSuffix(keyPath, ".key"), ".private")
+	pubFile, err := os.Open(keyPath + ".key")
+	if err != nil {
+		return nil, err
+	}
+	defer pubFile.Close()
+	rr, err := dns.ReadRR(pubFile, keyPath+".key")
+	if err != nil {
+		return nil, err
+	}
+	dnskey, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, fmt.Errorf("%s.key does not contain a dnskey record", keyPath)
+	}
+	privFile, err := os.Open(keyPath + ".private")
+	if err != nil {
+		return nil, err
+	}
+	defer privFile.Close()
+	privKey, err := dnskey.ReadPrivateKey(privFile, keyPath+".private")
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("private key from %s.private can not be used for signing", keyPath)
+	}
+	dnskey.Hdr.Name = strings.ToLower(dnskey.Hdr.Name)
+	return &DNSSECKey{
+		DNSKEY: dnskey,
+		Signer: signer,
+	}, nil
+}
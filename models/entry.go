@@ -1,11 +1,40 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/orange-cloudfoundry/go-netdisco"
+	pmodel "github.com/prometheus/common/model"
 )
 
+const (
+	AnswerOrderNone       = "none"
+	AnswerOrderRoundRobin = "round_robin"
+	AnswerOrderRandom     = "random"
+	AnswerOrderSorted     = "sorted"
+)
+
+const (
+	DeviceLabelName   = "name"
+	DeviceLabelSerial = "serial"
+	DeviceLabelMac    = "mac"
+)
+
+// DefaultEntry holds default records configuration, it is used for names which are not from an entry
+var DefaultEntry = &Entry{
+	TTL: pmodel.Duration(30 * time.Second),
+	SRV: []*SRVRecord{
+		{Port: 22, Priority: 1, Weight: 1},
+	},
+	TXT: &TXTConfig{
+		Fields: []string{"name", "vendor", "model", "os", "os_ver", "serial", "location"},
+	},
+}
+
 type Entries []*Entry
 
 type Entry struct {
@@ -13,6 +42,250 @@ type Entry struct {
 	Routing       *Routing                      `yaml:"routing" json:"-"`
 	EnableMetrics bool                          `yaml:"enable_metrics" json:"-"`
 	Targets       []*netdisco.SearchDeviceQuery `yaml:"targets" json:"targets"`
+	DeviceLabels  []string                      `yaml:"device_labels" json:"device_labels"`
+	TTL           pmodel.Duration               `yaml:"ttl" json:"ttl"`
+	SRV           []*SRVRecord                  `yaml:"srv" json:"srv"`
+	TXT           *TXTConfig                    `yaml:"txt" json:"txt"`
+	Freshness     *Freshness                    `yaml:"freshness" json:"freshness,omitempty"`
+	AnswerPolicy  *AnswerPolicy                 `yaml:"answer_policy" json:"answer_policy,omitempty"`
+	Alias         *Alias                        `yaml:"alias" json:"alias,omitempty"`
+	LOC           *LOCConfig                    `yaml:"loc" json:"loc,omitempty"`
+	IPAliases     *IPAliases                    `yaml:"ip_aliases" json:"ip_aliases,omitempty"`
+}
+
+// Alias make an entry domain a CNAME, either to a static target
+// or to the domain of another entry or to the name of the first device matching filter in another entry
+type Alias struct {
+	Target string        `yaml:"target" json:"target,omitempty"`
+	Entry  string        `yaml:"entry" json:"entry,omitempty"`
+	Filter *DeviceFilter `yaml:"filter" json:"filter,omitempty"`
+}
+
+func (a *Alias) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Alias
+	err := unmarshal((*plain)(a))
+	if err != nil {
+		return err
+	}
+	if (a.Target == "") == (a.Entry == "") {
+		return fmt.Errorf("alias must have either a target or an entry")
+	}
+	if a.Filter != nil && a.Entry == "" {
+		return fmt.Errorf("alias filter can only be used with an entry")
+	}
+	a.Target = strings.ToLower(strings.TrimSuffix(a.Target, "."))
+	a.Entry = strings.ToLower(strings.TrimSuffix(a.Entry, "."))
+	return nil
+}
+
+// Name give static target or domain of aliased entry
+func (a *Alias) Name() string {
+	if a.Target != "" {
+		return a.Target
+	}
+	return a.Entry
+}
+
+// FindByDomain give the entry with this domain, nil is returned if there is none
+func (es Entries) FindByDomain(domain string) *Entry {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, e := range es {
+		if strings.ToLower(e.Domain) == domain {
+			return e
+		}
+	}
+	return nil
+}
+
+// Validate check references between entries, aliases must not make a loop
+// and alias filter must be used on an entry with devices
+func (es Entries) Validate() error {
+	for _, e := range es {
+		if !e.IsAlias() {
+			continue
+		}
+		if e.Alias.Entry != "" {
+			target := es.FindByDomain(e.Alias.Entry)
+			if target == nil {
+				return fmt.Errorf("entry %s is an alias of entry %s which does not exist", e.Domain, e.Alias.Entry)
+			}
+			if target.IsAlias() && e.Alias.Filter != nil {
+				return fmt.Errorf("entry %s can not filter devices of entry %s which is an alias", e.Domain, e.Alias.Entry)
+			}
+		}
+		seen := map[*Entry]bool{e: true}
+		for current := es.FindByDomain(e.Alias.Name()); current.IsAlias(); current = es.FindByDomain(current.Alias.Name()) {
+			if seen[current] {
+				return fmt.Errorf("alias entry %s make a loop", e.Domain)
+			}
+			seen[current] = true
+		}
+	}
+	return nil
+}
+
+type AnswerPolicy struct {
+	Order string `yaml:"order" json:"order"`
+	Limit int    `yaml:"limit" json:"limit"`
+}
+
+func (p *AnswerPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain AnswerPolicy
+	err := unmarshal((*plain)(p))
+	if err != nil {
+		return err
+	}
+	if p.Order == "" {
+		p.Order = AnswerOrderNone
+	}
+	switch p.Order {
+	case AnswerOrderNone, AnswerOrderRoundRobin, AnswerOrderRandom, AnswerOrderSorted:
+	default:
+		return fmt.Errorf("answer order '%s' is not supported, use one of: %s, %s, %s, %s",
+			p.Order, AnswerOrderNone, AnswerOrderRoundRobin, AnswerOrderRandom, AnswerOrderSorted)
+	}
+	if p.Limit < 0 {
+		return fmt.Errorf("answer limit must be positive")
+	}
+	return nil
+}
+
+type Freshness struct {
+	MaxAge      pmodel.Duration `yaml:"max_age" json:"max_age"`
+	CheckUptime bool            `yaml:"check_uptime" json:"check_uptime"`
+	ServeStale  bool            `yaml:"serve_stale" json:"serve_stale"`
+}
+
+func (f *Freshness) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Freshness
+	err := unmarshal((*plain)(f))
+	if err != nil {
+		return err
+	}
+	if f.MaxAge <= 0 && !f.CheckUptime {
+		return fmt.Errorf("max_age or check_uptime must be set in freshness")
+	}
+	return nil
+}
+
+// IsFresh check if device has been discovered by netdisco since less than max age
+// and has an uptime if uptime must be checked, devices without known last discover date are considered fresh
+func (f *Freshness) IsFresh(device netdisco.Device, now time.Time) bool {
+	if f.CheckUptime && device.Uptime <= 0 {
+		return false
+	}
+	if f.MaxAge <= 0 {
+		return true
+	}
+	lastDiscover, ok := DeviceLastDiscover(device, now)
+	if !ok {
+		return true
+	}
+	return now.Sub(lastDiscover) <= time.Duration(f.MaxAge)
+}
+
+var lastDiscoverLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+}
+
+// DeviceLastDiscover give date of last discover of device by netdisco,
+// false is returned if date could not be found
+func DeviceLastDiscover(device netdisco.Device, now time.Time) (time.Time, bool) {
+	for _, value := range []string{device.LastDiscover, device.LastDiscoverStamp} {
+		if value == "" {
+			continue
+		}
+		for _, layout := range lastDiscoverLayouts {
+			lastDiscover, err := time.ParseInLocation(layout, value, time.Local)
+			if err == nil {
+				return lastDiscover, true
+			}
+		}
+	}
+	if device.SinceLastDiscover > 0 {
+		return now.Add(-time.Duration(float64(device.SinceLastDiscover) * float64(time.Second))), true
+	}
+	return time.Time{}, false
+}
+
+type TXTConfig struct {
+	Fields   []string `yaml:"fields" json:"fields"`
+	FullJSON bool     `yaml:"full_json" json:"full_json"`
+}
+
+func (c *TXTConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TXTConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if c.Fields == nil {
+		c.Fields = DefaultEntry.TXT.Fields
+	}
+	knownFields := DeviceFields(netdisco.Device{})
+	for _, field := range c.Fields {
+		if _, ok := knownFields[field]; !ok {
+			return fmt.Errorf("txt field '%s' is not a netdisco device field", field)
+		}
+	}
+	return nil
+}
+
+// DeviceFields give device fields as strings indexed by their netdisco name (e.g.: os_ver, last_discover)
+func DeviceFields(device netdisco.Device) map[string]string {
+	// could not happen error here
+	b, _ := json.Marshal(device) // nolint
+	rawFields := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	// keep numbers as is to not have them formatted as float
+	decoder.UseNumber()
+	decoder.Decode(&rawFields) // nolint
+	fields := make(map[string]string, len(rawFields))
+	for key, value := range rawFields {
+		fields[key] = fmt.Sprint(value)
+	}
+	return fields
+}
+
+type SRVRecord struct {
+	Service  string `yaml:"service" json:"service,omitempty"`
+	Proto    string `yaml:"proto" json:"proto,omitempty"`
+	Port     uint16 `yaml:"port" json:"port"`
+	Priority uint16 `yaml:"priority" json:"priority"`
+	Weight   uint16 `yaml:"weight" json:"weight"`
+}
+
+func (s *SRVRecord) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain SRVRecord
+	err := unmarshal((*plain)(s))
+	if err != nil {
+		return err
+	}
+	if s.Port == 0 {
+		return fmt.Errorf("port must be set for srv record")
+	}
+	s.Service = strings.ToLower(strings.TrimPrefix(s.Service, "_"))
+	s.Proto = strings.ToLower(strings.TrimPrefix(s.Proto, "_"))
+	if s.Service != "" && s.Proto == "" {
+		s.Proto = "tcp"
+	}
+	if s.Service == "" && s.Proto != "" {
+		return fmt.Errorf("service must be set when proto is set for srv record")
+	}
+	return nil
+}
+
+// Prefix give the labels to set before a name to get this srv record, e.g.: _ssh._tcp.
+// it is empty for srv record without service which are served directly on name
+func (s *SRVRecord) Prefix() string {
+	if s.Service == "" {
+		return ""
+	}
+	return "_" + s.Service + "._" + s.Proto + "."
 }
 
 func (e *Entry) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -24,11 +297,147 @@ func (e *Entry) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if e.Domain == "" {
 		return fmt.Errorf("domain must be set")
 	}
-	if len(e.Targets) == 0 {
+	// domain is used as key of devices cache whatever case of names asked
+	e.Domain = strings.ToLower(strings.TrimSuffix(e.Domain, "."))
+	if e.Alias != nil && len(e.Targets) > 0 {
+		return fmt.Errorf("targets can not be set on alias entry %s", e.Domain)
+	}
+	if e.Alias != nil && e.IPAliases != nil {
+		return fmt.Errorf("ip aliases can not be set on alias entry %s", e.Domain)
+	}
+	if e.Alias == nil && len(e.Targets) == 0 {
 		return fmt.Errorf("at least one target must be set")
 	}
 	for _, t := range e.Targets {
 		t.SeeAllColumns = true
 	}
+	if e.DeviceLabels == nil {
+		e.DeviceLabels = []string{DeviceLabelName}
+	}
+	if e.TTL <= 0 {
+		e.TTL = DefaultEntry.TTL
+	}
+	if e.SRV == nil {
+		e.SRV = DefaultEntry.SRV
+	}
+	if e.TXT == nil {
+		e.TXT = DefaultEntry.TXT
+	}
+	for _, label := range e.DeviceLabels {
+		switch label {
+		case DeviceLabelName, DeviceLabelSerial, DeviceLabelMac:
+		default:
+			return fmt.Errorf("device label '%s' is not supported, use one of: %s, %s, %s",
+				label, DeviceLabelName, DeviceLabelSerial, DeviceLabelMac)
+		}
+	}
 	return nil
 }
+
+// IsAlias check if entry is an alias to another name instead of a set of devices
+func (e *Entry) IsAlias() bool {
+	return e != nil && e.Alias != nil
+}
+
+// RecordTTL give ttl to use for records, default ttl is given when entry is nil
+func (e *Entry) RecordTTL() uint32 {
+	if e == nil || e.TTL <= 0 {
+		return DurationToTTL(DefaultEntry.TTL)
+	}
+	return DurationToTTL(e.TTL)
+}
+
+// FreshDevices remove stale devices as defined in freshness configuration,
+// stale devices are kept if there is no fresh device and entry allows to serve stale devices
+func (e *Entry) FreshDevices(devices []netdisco.Device, now time.Time) []netdisco.Device {
+	if e == nil || e.Freshness == nil {
+		return devices
+	}
+	freshDevices := make([]netdisco.Device, 0, len(devices))
+	for _, device := range devices {
+		if e.Freshness.IsFresh(device, now) {
+			freshDevices = append(freshDevices, device)
+		}
+	}
+	if len(freshDevices) == 0 && e.Freshness.ServeStale {
+		return devices
+	}
+	return freshDevices
+}
+
+// LOCForDevice give coordinates of device in LOC record format, empty string is given when they can't be found
+func (e *Entry) LOCForDevice(device netdisco.Device) string {
+	if e == nil {
+		return ""
+	}
+	return e.LOC.LOCFor(device.Location)
+}
+
+// TXTConfig give txt records configuration, default configuration is given when entry is nil
+func (e *Entry) TXTConfig() *TXTConfig {
+	if e == nil || e.TXT == nil {
+		return DefaultEntry.TXT
+	}
+	return e.TXT
+}
+
+// SRVRecordsFor give srv records configuration matching service and proto,
+// empty service give srv records served directly on entry domain, default srv records are used when entry is nil
+func (e *Entry) SRVRecordsFor(service, proto string) []*SRVRecord {
+	srvRecords := DefaultEntry.SRV
+	if e != nil {
+		srvRecords = e.SRV
+	}
+	service = strings.ToLower(service)
+	proto = strings.ToLower(proto)
+	finalSRVRecords := make([]*SRVRecord, 0)
+	for _, srvRecord := range srvRecords {
+		if srvRecord.Service == service && srvRecord.Proto == proto {
+			finalSRVRecords = append(finalSRVRecords, srvRecord)
+		}
+	}
+	return finalSRVRecords
+}
+
+// LabelsForDevice give all dns labels which can be used to reach this device under the entry domain
+// e.g.: label `sw1` make device resolvable on `sw1.<entry domain>`
+func (e *Entry) LabelsForDevice(device netdisco.Device) []string {
+	labels := make([]string, 0)
+	for _, labelType := range e.DeviceLabels {
+		var label string
+		switch labelType {
+		case DeviceLabelName:
+			label = device.Name
+			if label == "" {
+				label = device.DNS
+			}
+			// only keep short name as device name can be a fqdn
+			label = strings.SplitN(label, ".", 2)[0]
+		case DeviceLabelSerial:
+			label = device.Serial
+		case DeviceLabelMac:
+			label = device.Mac
+		}
+		label = sanitizeLabel(label)
+		if label == "" {
+			continue
+		}
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+func sanitizeLabel(label string) string {
+	label = strings.ToLower(label)
+	label = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, label)
+	label = strings.Trim(label, "-")
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return label
+}
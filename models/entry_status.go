@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// EntryStatus is the state of the last refreshes of an entry from netdisco.
+// An entry is stale when its devices were not retrieved by the last attempt,
+// because it failed or because devices come from cache file loaded at boot
+type EntryStatus struct {
+	Domain          string     `json:"domain"`
+	LastAttempt     *time.Time `json:"last_attempt,omitempty"`
+	LastSuccess     *time.Time `json:"last_success,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	DeviceCount     int        `json:"device_count"`
+	RefreshDuration float64    `json:"refresh_duration_seconds"`
+	Stale           bool       `json:"stale"`
+}
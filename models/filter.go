@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/orange-cloudfoundry/go-netdisco"
+)
+
+// DeviceFilter select devices by matching their fields, every criteria set must match,
+// string criteria are regular expressions and an empty filter match all devices
+type DeviceFilter struct {
+	Name       string `yaml:"name"`
+	DNS        string `yaml:"dns"`
+	Location   string `yaml:"location"`
+	Vendor     string `yaml:"vendor"`
+	Model      string `yaml:"model"`
+	Os         string `yaml:"os"`
+	IPPrefixes CIDRs  `yaml:"ip_prefixes"`
+
+	matchers map[string]*regexp.Regexp
+}
+
+func (f *DeviceFilter) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain DeviceFilter
+	err := unmarshal((*plain)(f))
+	if err != nil {
+		return err
+	}
+	return f.Compile()
+}
+
+// Compile check and compile regular expressions of filter, it is done when loading config
+// and must be done before using a filter built in code as Match only read compiled expressions
+func (f *DeviceFilter) Compile() error {
+	matchers := make(map[string]*regexp.Regexp)
+	for field, expr := range map[string]string{
+		"name":     f.Name,
+		"dns":      f.DNS,
+		"location": f.Location,
+		"vendor":   f.Vendor,
+		"model":    f.Model,
+		"os":       f.Os,
+	} {
+		if expr == "" {
+			continue
+		}
+		rx, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid %s filter '%s': %s", field, expr, err.Error())
+		}
+		matchers[field] = rx
+	}
+	f.matchers = matchers
+	return nil
+}
+
+// Match check if device match all criteria of filter, a nil filter match all devices.
+// Filter must have been compiled, it is only read so it can be used by concurrent queries
+func (f *DeviceFilter) Match(device netdisco.Device) bool {
+	if f == nil {
+		return true
+	}
+	values := map[string]string{
+		"name":     device.Name,
+		"dns":      device.DNS,
+		"location": device.Location,
+		"vendor":   device.Vendor,
+		"model":    device.Model,
+		"os":       device.Os,
+	}
+	for field, rx := range f.matchers {
+		if !rx.MatchString(values[field]) {
+			return false
+		}
+	}
+	if len(f.IPPrefixes) > 0 {
+		ip := net.ParseIP(device.IP)
+		if ip == nil || !f.IPPrefixes.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter give devices matching filter
+func (f *DeviceFilter) Filter(devices []netdisco.Device) []netdisco.Device {
+	if f == nil {
+		return devices
+	}
+	filtered := make([]netdisco.Device, 0, len(devices))
+	for _, device := range devices {
+		if f.Match(device) {
+			filtered = append(filtered, device)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
+// DeviceAddress is an ip address configured on a device as given by netdisco device_ips api,
+// Alias is the address and IP the primary address of device
+type DeviceAddress struct {
+	Alias  string `json:"alias"`
+	IP     string `json:"ip"`
+	Port   string `json:"port"`
+	Subnet string `json:"subnet"`
+	DNS    string `json:"dns"`
+}
+
+// IPAliases make an entry serve all ip addresses of its devices (loopbacks, svis, ...) and not only their primary ip,
+// each address is served as a copy of device with this address as ip.
+// Addresses can be restricted to subnets and to interfaces matching a regular expression, primary ip is always served
+type IPAliases struct {
+	Enable     bool   `yaml:"enable" json:"enable"`
+	Subnets    CIDRs  `yaml:"subnets" json:"-"`
+	Interfaces string `yaml:"interfaces" json:"interfaces,omitempty"`
+
+	interfaces *regexp.Regexp
+}
+
+func (a *IPAliases) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain IPAliases
+	err := unmarshal((*plain)(a))
+	if err != nil {
+		return err
+	}
+	if a.Interfaces == "" {
+		return nil
+	}
+	a.interfaces, err = regexp.Compile(a.Interfaces)
+	if err != nil {
+		return fmt.Errorf("invalid ip aliases interfaces '%s': %s", a.Interfaces, err.Error())
+	}
+	return nil
+}
+
+// IsEnabled check if ip aliases must be served
+func (a *IPAliases) IsEnabled() bool {
+	return a != nil && a.Enable
+}
+
+// Match check if an address of a device must be served
+func (a *IPAliases) Match(address DeviceAddress) bool {
+	ip := net.ParseIP(address.Alias)
+	if ip == nil {
+		return false
+	}
+	if len(a.Subnets) > 0 && !a.Subnets.Contains(ip) {
+		return false
+	}
+	if a.interfaces != nil && !a.interfaces.MatchString(address.Port) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// LOCConfig give how to find coordinates of a device from its netdisco location,
+// lookup table is tried first in order and then parser
+type LOCConfig struct {
+	Table  []*LOCLookup `yaml:"table" json:"table,omitempty"`
+	Parser string       `yaml:"parser" json:"parser,omitempty"`
+
+	parser *regexp.Regexp
+}
+
+// LOCLookup associate locations matching a regular expression to coordinates in LOC record format,
+// e.g.: 48 51 29.000 N 2 17 40.000 E 35.00m
+type LOCLookup struct {
+	Match string `yaml:"match" json:"match"`
+	LOC   string `yaml:"loc" json:"loc"`
+
+	match *regexp.Regexp
+}
+
+func (l *LOCLookup) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain LOCLookup
+	err := unmarshal((*plain)(l))
+	if err != nil {
+		return err
+	}
+	l.match, err = regexp.Compile(l.Match)
+	if err != nil {
+		return fmt.Errorf("invalid loc match '%s': %s", l.Match, err.Error())
+	}
+	if _, err := dns.NewRR(". IN LOC " + l.LOC); err != nil {
+		return fmt.Errorf("invalid loc '%s': %s", l.LOC, err.Error())
+	}
+	return nil
+}
+
+func (c *LOCConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain LOCConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	if c.Parser == "" {
+		return nil
+	}
+	c.parser, err = regexp.Compile(c.Parser)
+	if err != nil {
+		return fmt.Errorf("invalid loc parser '%s': %s", c.Parser, err.Error())
+	}
+	hasGroup := make(map[string]bool)
+	for _, name := range c.parser.SubexpNames() {
+		hasGroup[name] = true
+	}
+	if !hasGroup["lat"] || !hasGroup["long"] {
+		return fmt.Errorf("loc parser must have named groups lat and long")
+	}
+	return nil
+}
+
+// LOCFor give coordinates of a location in LOC record format, empty string is given if location is unknown.
+// Parser extract latitude, longitude and optional altitude in meters as decimal numbers from named groups
+// lat, long and alt.
+func (c *LOCConfig) LOCFor(location string) string {
+	if c == nil || location == "" {
+		return ""
+	}
+	for _, lookup := range c.Table {
+		if lookup.match.MatchString(location) {
+			return lookup.LOC
+		}
+	}
+	if c.parser == nil {
+		return ""
+	}
+	matches := c.parser.FindStringSubmatch(location)
+	if matches == nil {
+		return ""
+	}
+	values := make(map[string]float64)
+	for i, name := range c.parser.SubexpNames() {
+		// other named groups can be used by parser but are not coordinates
+		if (name != "lat" && name != "long" && name != "alt") || matches[i] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(matches[i], 64)
+		if err != nil {
+			return ""
+		}
+		values[name] = value
+	}
+	lat, okLat := values["lat"]
+	long, okLong := values["long"]
+	if !okLat || !okLong || math.Abs(lat) > 90 || math.Abs(long) > 180 {
+		return ""
+	}
+	return fmt.Sprintf("%s %s %.2fm", degreesToLOC(lat, "N", "S"), degreesToLOC(long, "E", "W"), values["alt"])
+}
+
+// degreesToLOC convert decimal degrees to degrees, minutes and seconds with hemisphere
+func degreesToLOC(value float64, positive, negative string) string {
+	hemisphere := positive
+	if value < 0 {
+		hemisphere = negative
+		value = -value
+	}
+	thousandths := int64(math.Round(value * 3600 * 1000))
+	degrees := thousandths / (3600 * 1000)
+	minutes := thousandths / (60 * 1000) % 60
+	seconds := float64(thousandths%(60*1000)) / 1000
+	return fmt.Sprintf("%d %d %.3f %s", degrees, minutes, seconds, hemisphere)
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestLOCFor(t *testing.T) {
+	var c LOCConfig
+	err := yaml.Unmarshal([]byte(`
+table:
+- match: '^Paris'
+  loc: 48 51 29.000 N 2 17 40.000 E 35.00m
+parser: '^(?P<room>\w+) \[(?P<lat>-?[0-9.]+),\s*(?P<long>-?[0-9.]+)(,\s*(?P<alt>-?[0-9.]+))?\]$'
+`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		location string
+		loc      string
+	}{
+		{"Paris DC1", "48 51 29.000 N 2 17 40.000 E 35.00m"},
+		{"room1 [48.858, 2.2945, 35]", "48 51 28.800 N 2 17 40.200 E 35.00m"},
+		{"room1 [48.858,2.2945]", "48 51 28.800 N 2 17 40.200 E 0.00m"},
+		{"room1 [-33.8688, 151.2093, -10.5]", "33 52 7.680 S 151 12 33.480 E -10.50m"},
+		{"room1 [0, -0.5]", "0 0 0.000 N 0 30 0.000 W 0.00m"},
+		// out of range coordinates
+		{"room1 [91, 2]", ""},
+		{"room1 [48, 181]", ""},
+		{"room1 [4.8.8, 2]", ""},
+		{"somewhere else", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := c.LOCFor(test.location); got != test.loc {
+			t.Errorf("LOCFor(%q) = %q, want %q", test.location, got, test.loc)
+		}
+	}
+
+	var nilConfig *LOCConfig
+	if got := nilConfig.LOCFor("Paris DC1"); got != "" {
+		t.Errorf("LOCFor on nil config = %q, want empty", got)
+	}
+}
+
+func TestLOCConfigUnmarshal(t *testing.T) {
+	tests := []struct {
+		config string
+		valid  bool
+	}{
+		{`parser: '(?P<lat>[0-9.]+) (?P<long>[0-9.]+)'`, true},
+		{`parser: '(?P<lat>[0-9.]+)'`, false},
+		{`parser: '(?P<lat>[0-9.]+'`, false},
+		{`table: [{match: 'Paris', loc: '48 51 29.000 N 2 17 40.000 E 35.00m'}]`, true},
+		{`table: [{match: 'Paris', loc: 'somewhere'}]`, false},
+		{`table: [{match: '(Paris', loc: '48 51 29.000 N 2 17 40.000 E 35.00m'}]`, false},
+	}
+	for _, test := range tests {
+		var c LOCConfig
+		err := yaml.Unmarshal([]byte(test.config), &c)
+		if (err == nil) != test.valid {
+			t.Errorf("unmarshal of %s: got error %v, want valid %t", test.config, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/orange-cloudfoundry/go-netdisco"
+)
+
+// View restrict devices served to clients from some networks,
+// client is matched by its source ip or by the address given in edns client subnet option when use_ecs is set.
+// As any client can set edns client subnet, it is only used from trusted resolvers given in ecs_trusted_sources
+type View struct {
+	Name              string        `yaml:"name"`
+	Sources           CIDRs         `yaml:"sources"`
+	UseECS            bool          `yaml:"use_ecs"`
+	ECSTrustedSources CIDRs         `yaml:"ecs_trusted_sources"`
+	Domains           []string      `yaml:"domains"`
+	Filter            *DeviceFilter `yaml:"filter"`
+}
+
+func (v *View) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain View
+	err := unmarshal((*plain)(v))
+	if err != nil {
+		return err
+	}
+	if v.Name == "" {
+		return fmt.Errorf("view must have a name")
+	}
+	if len(v.Sources) == 0 {
+		return fmt.Errorf("view %s must have at least one source", v.Name)
+	}
+	if v.UseECS && len(v.ECSTrustedSources) == 0 {
+		return fmt.Errorf("view %s use ecs and must have ecs trusted sources", v.Name)
+	}
+	for i, domain := range v.Domains {
+		v.Domains[i] = strings.ToLower(strings.TrimSuffix(domain, "."))
+	}
+	return nil
+}
+
+// MatchClient check if client ip, or ecs address when view use it and it is given by a trusted client, is in view sources
+func (v *View) MatchClient(clientIP, ecsIP net.IP) bool {
+	if v.UseECS && ecsIP != nil && clientIP != nil && v.ECSTrustedSources.Contains(clientIP) {
+		return v.Sources.Contains(ecsIP)
+	}
+	return clientIP != nil && v.Sources.Contains(clientIP)
+}
+
+// AppliesTo check if view restrict devices of entry, view applies to all entries when no domains are set
+func (v *View) AppliesTo(entry *Entry) bool {
+	if v == nil || entry == nil {
+		return false
+	}
+	if len(v.Domains) == 0 {
+		return true
+	}
+	entryDomain := strings.ToLower(entry.Domain)
+	for _, domain := range v.Domains {
+		if domain == entryDomain {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterDevices give devices of entry visible in the view, a nil view see all devices
+func (v *View) FilterDevices(entry *Entry, devices []netdisco.Device) []netdisco.Device {
+	if !v.AppliesTo(entry) {
+		return devices
+	}
+	return v.Filter.Filter(devices)
+}
+
+type Views []*View
+
+// ForClient give the first view matching client, nil is returned if client is in no view
+func (vs Views) ForClient(clientIP, ecsIP net.IP) *View {
+	for _, v := range vs {
+		if v.MatchClient(clientIP, ecsIP) {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"net"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestViewMatchClient(t *testing.T) {
+	var v View
+	err := yaml.Unmarshal([]byte(`
+name: admin
+sources: [10.1.0.0/16]
+use_ecs: true
+ecs_trusted_sources: [192.0.2.53]
+`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		clientIP string
+		ecsIP    string
+		match    bool
+	}{
+		{"client in sources", "10.1.2.3", "", true},
+		{"client out of sources", "10.2.2.3", "", false},
+		{"ecs from trusted resolver", "192.0.2.53", "10.1.2.3", true},
+		{"ecs from trusted resolver out of sources", "192.0.2.53", "10.2.2.3", false},
+		{"ecs from untrusted client is ignored", "10.2.2.3", "10.1.2.3", false},
+		{"ecs from untrusted client in sources is ignored", "10.1.2.3", "10.2.2.3", true},
+	}
+	for _, test := range tests {
+		if got := v.MatchClient(net.ParseIP(test.clientIP), net.ParseIP(test.ecsIP)); got != test.match {
+			t.Errorf("%s: MatchClient = %t, want %t", test.name, got, test.match)
+		}
+	}
+
+	err = yaml.Unmarshal([]byte(`{name: admin, sources: [10.1.0.0/16], use_ecs: true}`), &View{})
+	if err == nil {
+		t.Errorf("view using ecs without trusted sources must be rejected")
+	}
+}
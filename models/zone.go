@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	pmodel "github.com/prometheus/common/model"
+)
+
+type DNSZone struct {
+	Name    string          `yaml:"name" json:"name"`
+	NS      []string        `yaml:"ns" json:"ns"`
+	Mbox    string          `yaml:"mbox" json:"mbox"`
+	TTL     pmodel.Duration `yaml:"ttl" json:"ttl"`
+	Refresh pmodel.Duration `yaml:"refresh" json:"refresh"`
+	Retry   pmodel.Duration `yaml:"retry" json:"retry"`
+	Expire  pmodel.Duration `yaml:"expire" json:"expire"`
+	MinTTL  pmodel.Duration `yaml:"min_ttl" json:"min_ttl"`
+	DNSSEC  *DNSSECConfig   `yaml:"dnssec" json:"dnssec,omitempty"`
+}
+
+func (z *DNSZone) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain DNSZone
+	err := unmarshal((*plain)(z))
+	if err != nil {
+		return err
+	}
+	if z.Name == "" {
+		return fmt.Errorf("zone name must be set")
+	}
+	z.Name = dns.Fqdn(strings.ToLower(z.Name))
+	if len(z.NS) == 0 {
+		return fmt.Errorf("at least one ns must be set for zone %s", z.Name)
+	}
+	for i, ns := range z.NS {
+		z.NS[i] = dns.Fqdn(strings.ToLower(ns))
+	}
+	if z.Mbox == "" {
+		z.Mbox = "hostmaster." + z.Name
+	}
+	z.Mbox = dns.Fqdn(z.Mbox)
+	if z.TTL <= 0 {
+		z.TTL = pmodel.Duration(1 * time.Hour)
+	}
+	if z.Refresh <= 0 {
+		z.Refresh = pmodel.Duration(1 * time.Hour)
+	}
+	if z.Retry <= 0 {
+		z.Retry = pmodel.Duration(15 * time.Minute)
+	}
+	if z.Expire <= 0 {
+		z.Expire = pmodel.Duration(7 * 24 * time.Hour)
+	}
+	if z.MinTTL <= 0 {
+		z.MinTTL = pmodel.Duration(30 * time.Second)
+	}
+	if z.DNSSEC == nil {
+		return nil
+	}
+	for _, key := range z.DNSSEC.SigningKeys() {
+		if key.DNSKEY.Hdr.Name != z.Name {
+			return fmt.Errorf("dnssec key %d is for %s and can not sign zone %s", key.DNSKEY.KeyTag(), key.DNSKEY.Hdr.Name, z.Name)
+		}
+	}
+	return nil
+}
+
+// Signed check if zone is signed with dnssec
+func (z *DNSZone) Signed() bool {
+	return z.DNSSEC != nil && len(z.DNSSEC.SigningKeys()) > 0
+}
+
+// Contains check if a domain name is in this zone, domain name must be fully qualified
+func (z *DNSZone) Contains(domain string) bool {
+	return dns.IsSubDomain(z.Name, strings.ToLower(domain))
+}
+
+func DurationToTTL(d pmodel.Duration) uint32 {
+	return uint32(time.Duration(d) / time.Second)
+}
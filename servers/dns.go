@@ -2,6 +2,7 @@ package servers
 
 import (
 	"context"
+	"crypto/tls"
 	"time"
 
 	"github.com/miekg/dns"
@@ -25,7 +26,7 @@ func NewDNSServer(resolver *services.Resolver, config *models.DNSServerConfig) *
 
 func runDnsServer(srv *dns.Server) {
 	if err := srv.ListenAndServe(); err != nil {
-		log.Fatalf("Failed to set udp listener %s\n", err.Error())
+		log.Fatalf("Failed to set %s listener %s\n", srv.Net, err.Error())
 	}
 }
 
@@ -34,16 +35,32 @@ func (s *DNSServer) Run(ctx context.Context) {
 	udpServer := &dns.Server{
 		Addr:    s.config.Listen,
 		Net:     "udp",
-		Handler: s.resolver.MakeDNSHandler(true),
+		Handler: s.resolver.MakeDNSHandler(services.TransportUDP),
 	}
 	tcpServer := &dns.Server{
 		Addr:    s.config.Listen,
 		Net:     "tcp",
-		Handler: s.resolver.MakeDNSHandler(false),
+		Handler: s.resolver.MakeDNSHandler(services.TransportTCP),
 	}
 	entry.Infof("starting udp and tcp dns server on %s", s.config.Listen)
 	go runDnsServer(udpServer)
 	go runDnsServer(tcpServer)
+
+	var tlsServer *dns.Server
+	if s.config.DoT != nil && s.config.DoT.Enable {
+		certif, err := s.config.DoT.TLSPem.BuildCertif()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		tlsServer = &dns.Server{
+			Addr:      s.config.DoT.Listen,
+			Net:       "tcp-tls",
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{certif}},
+			Handler:   s.resolver.MakeDNSHandler(services.TransportTLS),
+		}
+		entry.Infof("starting dns over tls server on %s", s.config.DoT.Listen)
+		go runDnsServer(tlsServer)
+	}
 	<-ctx.Done()
 	log.Info("Graceful shutdown dns server ...")
 	ctxTimeout, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
@@ -57,7 +74,16 @@ func (s *DNSServer) Run(ctx context.Context) {
 	defer cancelFunc()
 	err = tcpServer.ShutdownContext(ctxTimeout)
 	if err != nil {
-		log.Errorf("error when shutdown udp dns server: %s", err.Error())
+		log.Errorf("error when shutdown tcp dns server: %s", err.Error())
+	}
+
+	if tlsServer != nil {
+		ctxTimeout, cancelFunc = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFunc()
+		err = tlsServer.ShutdownContext(ctxTimeout)
+		if err != nil {
+			log.Errorf("error when shutdown dns over tls server: %s", err.Error())
+		}
 	}
 	log.Info("Finished graceful shutdown dns server ...")
 }
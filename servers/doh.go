@@ -0,0 +1,254 @@
+package servers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dnsMessageContentType = "application/dns-message"
+	dnsJsonContentType    = "application/dns-json"
+	// dohMaxMsgSize is the maximum size of a dns message as defined in rfc8484
+	dohMaxMsgSize = 65535
+)
+
+// dohResponseWriter let us use the dns handler on http by keeping message written by handler
+type dohResponseWriter struct {
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	msg        *dns.Msg
+}
+
+func newDohResponseWriter(req *http.Request) *dohResponseWriter {
+	localAddr, _ := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	remoteAddr := &net.TCPAddr{}
+	host, port, err := net.SplitHostPort(req.RemoteAddr)
+	if err == nil {
+		remoteAddr.IP = net.ParseIP(host)
+		remoteAddr.Port, _ = strconv.Atoi(port)
+	}
+	return &dohResponseWriter{
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+	}
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr {
+	return w.localAddr
+}
+
+func (w *dohResponseWriter) RemoteAddr() net.Addr {
+	return w.remoteAddr
+}
+
+func (w *dohResponseWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+	return nil
+}
+
+func (w *dohResponseWriter) Write(b []byte) (int, error) {
+	msg := new(dns.Msg)
+	err := msg.Unpack(b)
+	if err != nil {
+		return 0, err
+	}
+	w.msg = msg
+	return len(b), nil
+}
+
+func (w *dohResponseWriter) Close() error {
+	return nil
+}
+
+func (w *dohResponseWriter) TsigStatus() error {
+	return nil
+}
+
+func (w *dohResponseWriter) TsigTimersOnly(bool) {}
+
+func (w *dohResponseWriter) Hijack() {}
+
+// dnsQuery implements rfc8484 dns over https with GET and POST methods,
+// it also answers to json queries made with `name` parameter.
+// Json queries are answered in json unless `application/dns-message` is accepted,
+// wire format queries are answered in wire format unless `application/dns-json` is accepted
+func (s *HTTPServer) dnsQuery(w http.ResponseWriter, req *http.Request) {
+	msg, jsonQuery, err := s.dohRequestMsg(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(msg.Question) != 1 {
+		http.Error(w, "one question must be set", http.StatusBadRequest)
+		return
+	}
+	if msg.Question[0].Qtype == dns.TypeAXFR || msg.Question[0].Qtype == dns.TypeIXFR {
+		http.Error(w, "zone transfers are not supported over https", http.StatusBadRequest)
+		return
+	}
+
+	dohWriter := newDohResponseWriter(req)
+	s.dnsHandler.ServeDNS(dohWriter, msg)
+	if dohWriter.msg == nil {
+		http.Error(w, "no dns response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", minTTL(dohWriter.msg)))
+	accept := req.Header.Get("Accept")
+	useJson := strings.Contains(accept, dnsJsonContentType) || jsonQuery && !strings.Contains(accept, dnsMessageContentType)
+	if useJson {
+		w.Header().Set("Content-Type", dnsJsonContentType)
+		json.NewEncoder(w).Encode(dnsMsgToJson(dohWriter.msg)) //nolint
+		return
+	}
+	b, err := dohWriter.msg.Pack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", dnsMessageContentType)
+	w.Write(b) //nolint
+}
+
+// dohRequestMsg give dns message of request, format of request is found from parameters and content type:
+// wire format with `dns` parameter in GET or `application/dns-message` body in POST, json with `name` parameter in GET.
+// True is returned when request is in json
+func (s *HTTPServer) dohRequestMsg(req *http.Request) (*dns.Msg, bool, error) {
+	var b []byte
+	var err error
+	query := req.URL.Query()
+	switch {
+	case req.Method == http.MethodGet && query.Get("dns") != "":
+		b, err = base64.RawURLEncoding.DecodeString(query.Get("dns"))
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid dns parameter: %s", err.Error())
+		}
+	case req.Method == http.MethodGet && query.Get("name") != "":
+		msg, err := dohJsonRequestMsg(req)
+		return msg, true, err
+	case req.Method == http.MethodGet:
+		return nil, false, fmt.Errorf("dns or name parameter must be set")
+	case req.Method == http.MethodPost:
+		if req.Header.Get("Content-Type") != dnsMessageContentType {
+			return nil, false, fmt.Errorf("content type must be %s", dnsMessageContentType)
+		}
+		b, err = io.ReadAll(io.LimitReader(req.Body, dohMaxMsgSize))
+		if err != nil {
+			return nil, false, err
+		}
+	default:
+		return nil, false, fmt.Errorf("method %s not allowed", req.Method)
+	}
+	msg := new(dns.Msg)
+	err = msg.Unpack(b)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid dns message: %s", err.Error())
+	}
+	return msg, false, nil
+}
+
+func dohJsonRequestMsg(req *http.Request) (*dns.Msg, error) {
+	query := req.URL.Query()
+	name := query.Get("name")
+	if _, ok := dns.IsDomainName(name); !ok {
+		return nil, fmt.Errorf("invalid name '%s'", name)
+	}
+	qtype := dns.TypeA
+	if typeParam := query.Get("type"); typeParam != "" {
+		var ok bool
+		qtype, ok = dns.StringToType[strings.ToUpper(typeParam)]
+		if !ok {
+			typeInt, err := strconv.ParseUint(typeParam, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid type '%s'", typeParam)
+			}
+			qtype = uint16(typeInt)
+		}
+	}
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.CheckingDisabled = query.Get("cd") == "1" || query.Get("cd") == "true"
+	if do := query.Get("do"); do == "1" || do == "true" {
+		msg.SetEdns0(dns.DefaultMsgSize, true)
+	}
+	return msg, nil
+}
+
+type dnsJsonQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+type dnsJsonRR struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+type dnsJsonMsg struct {
+	Status    int               `json:"Status"`
+	TC        bool              `json:"TC"`
+	RD        bool              `json:"RD"`
+	RA        bool              `json:"RA"`
+	AD        bool              `json:"AD"`
+	CD        bool              `json:"CD"`
+	Question  []dnsJsonQuestion `json:"Question"`
+	Answer    []dnsJsonRR       `json:"Answer,omitempty"`
+	Authority []dnsJsonRR       `json:"Authority,omitempty"`
+}
+
+func dnsMsgToJson(msg *dns.Msg) dnsJsonMsg {
+	jsonMsg := dnsJsonMsg{
+		Status:   msg.Rcode,
+		TC:       msg.Truncated,
+		RD:       msg.RecursionDesired,
+		RA:       msg.RecursionAvailable,
+		AD:       msg.AuthenticatedData,
+		CD:       msg.CheckingDisabled,
+		Question: make([]dnsJsonQuestion, len(msg.Question)),
+	}
+	for i, q := range msg.Question {
+		jsonMsg.Question[i] = dnsJsonQuestion{Name: q.Name, Type: q.Qtype}
+	}
+	jsonMsg.Answer = rrsToJson(msg.Answer)
+	jsonMsg.Authority = rrsToJson(msg.Ns)
+	return jsonMsg
+}
+
+func rrsToJson(rrs []dns.RR) []dnsJsonRR {
+	jsonRRs := make([]dnsJsonRR, len(rrs))
+	for i, rr := range rrs {
+		hdr := rr.Header()
+		jsonRRs[i] = dnsJsonRR{
+			Name: hdr.Name,
+			Type: hdr.Rrtype,
+			TTL:  hdr.Ttl,
+			Data: strings.TrimPrefix(rr.String(), hdr.String()),
+		}
+	}
+	return jsonRRs
+}
+
+// minTTL give the minimum ttl of records in answer to use it for http caching
+func minTTL(msg *dns.Msg) uint32 {
+	var ttl uint32
+	found := false
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range rrs {
+			if !found || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				found = true
+			}
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,62 @@
+package servers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDohRequestMsg(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("all.netdisco.", dns.TypeAAAA)
+	wire, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnsParam := base64.RawURLEncoding.EncodeToString(wire)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		accept      string
+		jsonQuery   bool
+		valid       bool
+	}{
+		{"get wire", http.MethodGet, "/dns-query?dns=" + dnsParam, "", dnsMessageContentType, false, true},
+		{"get wire accepting json", http.MethodGet, "/dns-query?dns=" + dnsParam, "", dnsJsonContentType, false, true},
+		{"get json", http.MethodGet, "/dns-query?name=all.netdisco&type=AAAA", "", "", true, true},
+		{"get json accepting wire", http.MethodGet, "/dns-query?name=all.netdisco&type=AAAA", "", dnsMessageContentType, true, true},
+		{"post wire", http.MethodPost, "/dns-query", dnsMessageContentType, dnsJsonContentType, false, true},
+		{"get without query", http.MethodGet, "/dns-query", "", dnsJsonContentType, false, false},
+		{"post without content type", http.MethodPost, "/dns-query", "", "", false, false},
+		{"invalid method", http.MethodPut, "/dns-query?dns=" + dnsParam, "", "", false, false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.target, bytes.NewReader(wire))
+		req.Header.Set("Content-Type", test.contentType)
+		req.Header.Set("Accept", test.accept)
+		msg, jsonQuery, err := (&HTTPServer{}).dohRequestMsg(req)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: request must be refused", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+		if jsonQuery != test.jsonQuery {
+			t.Errorf("%s: json query is %t, want %t", test.name, jsonQuery, test.jsonQuery)
+		}
+		if len(msg.Question) != 1 || msg.Question[0].Name != "all.netdisco." || msg.Question[0].Qtype != dns.TypeAAAA {
+			t.Errorf("%s: unexpected question %v", test.name, msg.Question)
+		}
+	}
+}
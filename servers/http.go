@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/miekg/dns"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 
@@ -21,16 +22,18 @@ import (
 )
 
 type HTTPServer struct {
-	resolver *services.Resolver
-	config   *models.HTTPServerConfig
-	mux      *mux.Router
+	resolver   *services.Resolver
+	config     *models.HTTPServerConfig
+	mux        *mux.Router
+	dnsHandler dns.Handler
 }
 
 func NewHTTPServer(resolver *services.Resolver, config *models.HTTPServerConfig) *HTTPServer {
 	return &HTTPServer{
-		resolver: resolver,
-		config:   config,
-		mux:      mux.NewRouter(),
+		resolver:   resolver,
+		config:     config,
+		mux:        mux.NewRouter(),
+		dnsHandler: resolver.MakeDNSHandler(services.TransportHTTPS),
 	}
 }
 
@@ -89,6 +92,29 @@ func (s *HTTPServer) listIps(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(ips) //nolint
 }
 
+func (s *HTTPServer) entryStatus(w http.ResponseWriter, req *http.Request) {
+	status, ok := s.resolver.EntryStatus(mux.Vars(req)["domain"])
+	if !ok {
+		http.Error(w, "entry not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status) //nolint
+}
+
+func (s *HTTPServer) zoneFile(w http.ResponseWriter, req *http.Request) {
+	zone := s.resolver.Zone(mux.Vars(req)["zone"])
+	if zone == nil {
+		http.Error(w, "zone not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/dns")
+	err := s.resolver.WriteZoneFile(w, zone)
+	if err != nil {
+		log.Errorf("error when writing zone file: %s", err.Error())
+	}
+}
+
 func (s *HTTPServer) searchDevices(w http.ResponseWriter, req *http.Request) {
 	err := req.ParseForm()
 	if err != nil {
@@ -136,6 +162,7 @@ func (s *HTTPServer) searchDevices(w http.ResponseWriter, req *http.Request) {
 
 func (s *HTTPServer) Run(ctx context.Context) {
 	s.mux.Path("/metrics").Handler(promhttp.Handler())
+	s.mux.Path("/dns-query").Methods(http.MethodGet, http.MethodPost).HandlerFunc(s.dnsQuery)
 	subRouter := s.mux.PathPrefix("/api/v1").Subrouter()
 	subRouter.HandleFunc("/search/devices", s.searchDevices)
 	subRouter.HandleFunc("/entries/*/routes", s.listRoutes)
@@ -145,6 +172,8 @@ func (s *HTTPServer) Run(ctx context.Context) {
 	subRouter.HandleFunc("/entries/{domain}/devices", s.listDevices)
 	subRouter.HandleFunc("/entries/{domain}/hosts", s.listHosts)
 	subRouter.HandleFunc("/entries/{domain}/ips", s.listIps)
+	subRouter.HandleFunc("/entries/{domain}/status", s.entryStatus)
+	subRouter.HandleFunc("/zones/{zone}/zonefile", s.zoneFile)
 	listener, err := s.makeListener()
 	if err != nil {
 		log.Fatal(err.Error())
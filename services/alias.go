@@ -0,0 +1,78 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/orange-cloudfoundry/go-netdisco"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// maxAliasChain is the maximum number of cname followed when resolving an alias
+const maxAliasChain = 8
+
+// aliasTarget give the fqdn targeted by an alias entry, when alias use a filter on entry devices
+// target is the name of the first matching device visible in view, in alphabetical order.
+// Empty string is returned when no device match.
+func (r *Resolver) aliasTarget(entry *models.Entry, view *models.View) string {
+	alias := entry.Alias
+	if alias.Entry == "" || alias.Filter == nil {
+		return dns.Fqdn(alias.Name())
+	}
+	targetEntry := r.entries.FindByDomain(alias.Entry)
+	names := make([]string, 0)
+	for _, device := range alias.Filter.Filter(view.FilterDevices(targetEntry, r.DevicesFromEntry(targetEntry))) {
+		labels := targetEntry.LabelsForDevice(device)
+		if len(labels) == 0 {
+			continue
+		}
+		names = append(names, labels[0]+"."+strings.ToLower(targetEntry.Domain))
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return dns.Fqdn(names[0])
+}
+
+// aliasCNAME give cname record of an alias entry, no record is given when alias has no target
+func (r *Resolver) aliasCNAME(entry *models.Entry, domain string, view *models.View) []dns.RR {
+	target := r.aliasTarget(entry, view)
+	if target == "" {
+		return []dns.RR{}
+	}
+	return []dns.RR{&dns.CNAME{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(strings.ToLower(domain)),
+			Rrtype: dns.TypeCNAME,
+			Class:  dns.ClassINET,
+			Ttl:    entry.RecordTTL(),
+		},
+		Target: target,
+	}}
+}
+
+// resolveAlias answer cname of alias entry followed by records of its target,
+// chain is only followed when target is a name we answer for
+func (r *Resolver) resolveAlias(entry *models.Entry, domain string, queryType uint16, view *models.View, depth int) []dns.RR {
+	rrs := r.aliasCNAME(entry, domain, view)
+	if len(rrs) == 0 || queryType == dns.TypeCNAME || depth >= maxAliasChain {
+		return rrs
+	}
+	target := rrs[0].(*dns.CNAME).Target
+	if r.forwarder != nil && !r.isLocalName(target) {
+		return rrs
+	}
+	return append(rrs, r.resolveChain(strings.TrimSuffix(target, "."), queryType, view, depth+1)...)
+}
+
+// aliasDevices give devices targeted by an alias entry
+func (r *Resolver) aliasDevices(entry *models.Entry) []netdisco.Device {
+	target := r.aliasTarget(entry, nil)
+	if target == "" {
+		return []netdisco.Device{}
+	}
+	return r.ResolveDevices(strings.TrimSuffix(target, "."))
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// answerPolicies apply ordering and limit set in entries on address records
+type answerPolicies struct {
+	rrCounters *sync.Map
+	randMutex  sync.Mutex
+	rand       *rand.Rand
+}
+
+func newAnswerPolicies() *answerPolicies {
+	return &answerPolicies{
+		rrCounters: &sync.Map{},
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Apply order and limit address records, limit is applied before udp truncation
+// so client always receive the first records chosen by policy
+func (p *answerPolicies) Apply(entry *models.Entry, domain string, queryType uint16, rrs []dns.RR) []dns.RR {
+	if entry == nil || entry.AnswerPolicy == nil || len(rrs) == 0 {
+		return rrs
+	}
+	if queryType != dns.TypeA && queryType != dns.TypeAAAA {
+		return rrs
+	}
+	policy := entry.AnswerPolicy
+	switch policy.Order {
+	case models.AnswerOrderRoundRobin:
+		rrs = p.rotate(domain, queryType, rrs)
+	case models.AnswerOrderRandom:
+		rrs = p.shuffle(rrs)
+	case models.AnswerOrderSorted:
+		rrs = sortAddressRRs(rrs)
+	}
+	if policy.Limit > 0 && len(rrs) > policy.Limit {
+		rrs = rrs[:policy.Limit]
+	}
+	return rrs
+}
+
+func (p *answerPolicies) rotate(domain string, queryType uint16, rrs []dns.RR) []dns.RR {
+	key := domain + "$" + strconv.Itoa(int(queryType))
+	counterRaw, _ := p.rrCounters.LoadOrStore(key, new(uint32))
+	offset := int(atomic.AddUint32(counterRaw.(*uint32), 1)-1) % len(rrs)
+	rotated := make([]dns.RR, 0, len(rrs))
+	rotated = append(rotated, rrs[offset:]...)
+	return append(rotated, rrs[:offset]...)
+}
+
+func (p *answerPolicies) shuffle(rrs []dns.RR) []dns.RR {
+	shuffled := make([]dns.RR, len(rrs))
+	copy(shuffled, rrs)
+	p.randMutex.Lock()
+	defer p.randMutex.Unlock()
+	p.rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+func sortAddressRRs(rrs []dns.RR) []dns.RR {
+	sorted := make([]dns.RR, len(rrs))
+	copy(sorted, rrs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return bytes.Compare(rrIP(sorted[i]), rrIP(sorted[j])) < 0
+	})
+	return sorted
+}
+
+func rrIP(rr dns.RR) []byte {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A.To16()
+	case *dns.AAAA:
+		return v.AAAA.To16()
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// signatureInceptionSkew is the time before now set as signatures inception to handle clients with clock skew
+const signatureInceptionSkew = time.Hour
+
+// nsecTypes are types which can exist at a name synthesized from devices, they are checked for building nsec bitmap
+var nsecTypes = []uint16{
+	dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeTXT, dns.TypeSRV, dns.TypePTR, dns.TypeHINFO, dns.TypeLOC,
+}
+
+type cachedSignature struct {
+	sig       *dns.RRSIG
+	refreshAt time.Time
+}
+
+// signatureCache keep signatures of rrsets to not sign again the same rrsets on each query,
+// signatures are made again when a quarter of their validity has passed
+type signatureCache struct {
+	mutex     sync.Mutex
+	sigs      map[uint64]*cachedSignature
+	lastPurge time.Time
+}
+
+func newSignatureCache() *signatureCache {
+	return &signatureCache{
+		sigs:      make(map[uint64]*cachedSignature),
+		lastPurge: time.Now(),
+	}
+}
+
+func (c *signatureCache) sign(zone *models.DNSZone, key *models.DNSSECKey, rrset []dns.RR) (*dns.RRSIG, error) {
+	now := time.Now()
+	cacheKey := rrsetHash(key, rrset)
+	c.mutex.Lock()
+	cached, ok := c.sigs[cacheKey]
+	c.mutex.Unlock()
+	if ok && now.Before(cached.refreshAt) {
+		return cached.sig, nil
+	}
+	validity := time.Duration(zone.DNSSEC.SignatureValidity)
+	sig := &dns.RRSIG{
+		Hdr: dns.RR_Header{
+			Name:   rrset[0].Header().Name,
+			Rrtype: dns.TypeRRSIG,
+			Class:  dns.ClassINET,
+			Ttl:    rrset[0].Header().Ttl,
+		},
+		Algorithm:  key.DNSKEY.Algorithm,
+		KeyTag:     key.DNSKEY.KeyTag(),
+		SignerName: zone.Name,
+		Inception:  uint32(now.Add(-signatureInceptionSkew).Unix()),
+		Expiration: uint32(now.Add(validity).Unix()),
+	}
+	err := sig.Sign(key.Signer, rrset)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if now.Sub(c.lastPurge) > validity/4 {
+		c.lastPurge = now
+		for k, s := range c.sigs {
+			if now.After(s.refreshAt) {
+				delete(c.sigs, k)
+			}
+		}
+	}
+	c.sigs[cacheKey] = &cachedSignature{
+		sig:       sig,
+		refreshAt: now.Add(validity / 4),
+	}
+	return sig, nil
+}
+
+// rrsetHash identify a rrset signed by a key whatever the order of records
+func rrsetHash(key *models.DNSSECKey, rrset []dns.RR) uint64 {
+	rrStrings := make([]string, len(rrset))
+	for i, rr := range rrset {
+		rrStrings[i] = strings.ToLower(rr.String())
+	}
+	sort.Strings(rrStrings)
+	h := xxhash.New()
+	_, _ = h.WriteString(key.DNSKEY.Hdr.Name + strconv.Itoa(int(key.DNSKEY.KeyTag())))
+	for _, s := range rrStrings {
+		_, _ = h.Write([]byte{models.SeparatorByte})
+		_, _ = h.WriteString(s)
+	}
+	return h.Sum64()
+}
+
+// zoneDNSKEY give dnskey records of a signed zone
+func (r *Resolver) zoneDNSKEY(zone *models.DNSZone) []dns.RR {
+	rrs := make([]dns.RR, 0)
+	for _, key := range zone.DNSSEC.SigningKeys() {
+		dnskey := dns.Copy(key.DNSKEY).(*dns.DNSKEY)
+		dnskey.Hdr.Ttl = models.DurationToTTL(zone.TTL)
+		rrs = append(rrs, dnskey)
+	}
+	return rrs
+}
+
+// zoneNSEC give a nsec record proving that qname has no record of other types than those in bitmap,
+// next name is the immediate successor of qname (minimally covering nsec, aka "black lies")
+// so it can also be used to answer NODATA instead of NXDOMAIN for names which don't exist without zone walking
+func (r *Resolver) zoneNSEC(zone *models.DNSZone, qname string, view *models.View) dns.RR {
+	qname = dns.Fqdn(strings.ToLower(qname))
+	domain := strings.TrimSuffix(qname, ".")
+	bitmap := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+	if qname == zone.Name {
+		bitmap = append(bitmap, dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY)
+	}
+	for _, qtype := range nsecTypes {
+		if len(r.resolveRRs(domain, qtype, view)) > 0 {
+			bitmap = append(bitmap, qtype)
+		}
+	}
+	sort.Slice(bitmap, func(i, j int) bool {
+		return bitmap[i] < bitmap[j]
+	})
+	return &dns.NSEC{
+		Hdr: dns.RR_Header{
+			Name:   qname,
+			Rrtype: dns.TypeNSEC,
+			Class:  dns.ClassINET,
+			Ttl:    models.DurationToTTL(zone.MinTTL),
+		},
+		NextDomain: "\\000." + qname,
+		TypeBitMap: bitmap,
+	}
+}
+
+// signReply add rrsig records for all rrsets of answer and authority sections which are in a signed zone
+func (r *Resolver) signReply(reply *dns.Msg) {
+	reply.Answer = append(reply.Answer, r.signRRs(reply.Answer)...)
+	reply.Ns = append(reply.Ns, r.signRRs(reply.Ns)...)
+}
+
+func (r *Resolver) signRRs(rrs []dns.RR) []dns.RR {
+	sigs := make([]dns.RR, 0)
+	for _, rrset := range splitRRSets(rrs) {
+		zone := r.findZone(rrset[0].Header().Name)
+		if zone == nil || !zone.Signed() {
+			continue
+		}
+		isDNSKEY := rrset[0].Header().Rrtype == dns.TypeDNSKEY
+		for _, key := range zoneSigningKeys(zone, isDNSKEY) {
+			sig, err := r.signatures.sign(zone, key, rrset)
+			if err != nil {
+				log.Errorf("error when signing %s records for %s: %s",
+					dns.TypeToString[rrset[0].Header().Rrtype], rrset[0].Header().Name, err.Error())
+				continue
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// zoneSigningKeys give keys which must sign a rrset, ksk sign dnskey rrset and zsk sign others,
+// when zone only have one type of key they sign all rrsets (e.g.: zone with a csk)
+func zoneSigningKeys(zone *models.DNSZone, isDNSKEY bool) []*models.DNSSECKey {
+	ksks := make([]*models.DNSSECKey, 0)
+	zsks := make([]*models.DNSSECKey, 0)
+	for _, key := range zone.DNSSEC.SigningKeys() {
+		if key.IsKSK() {
+			ksks = append(ksks, key)
+		} else {
+			zsks = append(zsks, key)
+		}
+	}
+	if (isDNSKEY && len(ksks) > 0) || len(zsks) == 0 {
+		return ksks
+	}
+	return zsks
+}
+
+// splitRRSets group records by name, type and class in order of first appearance, rrsig and opt records are ignored
+func splitRRSets(rrs []dns.RR) [][]dns.RR {
+	rrsets := make([][]dns.RR, 0)
+	index := make(map[string]int)
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeRRSIG || hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+		key := strings.ToLower(hdr.Name) + "$" + strconv.Itoa(int(hdr.Rrtype)) + "$" + strconv.Itoa(int(hdr.Class))
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(rrsets)
+			rrsets = append(rrsets, []dns.RR{rr})
+			continue
+		}
+		rrsets[i] = append(rrsets[i], rr)
+	}
+	return rrsets
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// writeTestKey generate a key for zone example. and write it in bind format, path without extension is given
+func writeTestKey(t *testing.T, dir string, flags uint16) string {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "Kexample.+013+"+strconv.Itoa(int(key.KeyTag())))
+	err = os.WriteFile(base+".key", []byte(key.String()+"\n"), 0600)
+	if err == nil {
+		err = os.WriteFile(base+".private", []byte(key.PrivateKeyString(priv)), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base
+}
+
+func newSignedTestResolver(t *testing.T) *Resolver {
+	dir := t.TempDir()
+	ksk := writeTestKey(t, dir, dns.ZONE|dns.SEP)
+	zsk := writeTestKey(t, dir, dns.ZONE)
+	return newTestResolver(t, `
+netdisco: {endpoint: http://netdisco}
+dns_server:
+  zones:
+  - name: example
+    ns: [ns1.example]
+    dnssec: {keys: [`+ksk+`, `+zsk+`]}
+entries:
+- domain: all.example
+  targets: [{q: '%'}]
+`)
+}
+
+func TestZoneNSEC(t *testing.T) {
+	r := newSignedTestResolver(t)
+	zone := r.Zone("example")
+	tests := []struct {
+		qname  string
+		bitmap []uint16
+	}{
+		{"example.", []uint16{dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY}},
+		{"all.example.", []uint16{dns.TypeA, dns.TypeHINFO, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC}},
+		{"sw1.all.example.", []uint16{dns.TypeA, dns.TypeHINFO, dns.TypeTXT, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC}},
+		{"SW3.All.Example.", []uint16{dns.TypeHINFO, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC}},
+		{"unknown.example.", []uint16{dns.TypeRRSIG, dns.TypeNSEC}},
+	}
+	for _, test := range tests {
+		nsec := r.zoneNSEC(zone, test.qname, nil).(*dns.NSEC)
+		if nsec.Hdr.Name != dns.CanonicalName(test.qname) {
+			t.Errorf("%s: nsec owner is %s", test.qname, nsec.Hdr.Name)
+		}
+		// minimally covering nsec: next name is the immediate successor of qname
+		if nsec.NextDomain != "\\000."+dns.CanonicalName(test.qname) {
+			t.Errorf("%s: nsec next domain is %s", test.qname, nsec.NextDomain)
+		}
+		if !reflect.DeepEqual(nsec.TypeBitMap, test.bitmap) {
+			t.Errorf("%s: nsec bitmap is %v, want %v", test.qname, nsec.TypeBitMap, test.bitmap)
+		}
+	}
+}
+
+func TestSignReplyVerify(t *testing.T) {
+	r := newSignedTestResolver(t)
+	zone := r.Zone("example")
+	keys := make(map[uint16]*dns.DNSKEY)
+	for _, rr := range r.zoneDNSKEY(zone) {
+		key := rr.(*dns.DNSKEY)
+		keys[key.KeyTag()] = key
+	}
+	reply := new(dns.Msg)
+	reply.Answer = append(r.zoneDNSKEY(zone), r.Resolve("all.example", dns.TypeA)...)
+	reply.Ns = []dns.RR{r.zoneNSEC(zone, "unknown.example.", nil)}
+	r.signReply(reply)
+
+	for _, section := range [][]dns.RR{reply.Answer, reply.Ns} {
+		rrsets := splitRRSets(section)
+		sigs := make(map[uint16]int)
+		for _, rr := range section {
+			sig, ok := rr.(*dns.RRSIG)
+			if !ok {
+				continue
+			}
+			key := keys[sig.KeyTag]
+			if key == nil {
+				t.Fatalf("rrsig of %s made with unknown key %d", sig.Hdr.Name, sig.KeyTag)
+			}
+			if sig.TypeCovered == dns.TypeDNSKEY && key.Flags&dns.SEP == 0 {
+				t.Errorf("dnskey rrset must be signed by ksk")
+			}
+			if sig.TypeCovered != dns.TypeDNSKEY && key.Flags&dns.SEP != 0 {
+				t.Errorf("%s rrset must be signed by zsk", dns.TypeToString[sig.TypeCovered])
+			}
+			if !sig.ValidityPeriod(time.Now()) {
+				t.Errorf("rrsig of %s is not valid now", sig.Hdr.Name)
+			}
+			verified := false
+			for _, rrset := range rrsets {
+				if rrset[0].Header().Rrtype == sig.TypeCovered && rrset[0].Header().Name == sig.Hdr.Name {
+					if err := sig.Verify(key, rrset); err != nil {
+						t.Errorf("rrsig of %s %s does not verify: %s", sig.Hdr.Name, dns.TypeToString[sig.TypeCovered], err.Error())
+					}
+					verified = true
+				}
+			}
+			if !verified {
+				t.Errorf("rrsig of %s %s cover no rrset", sig.Hdr.Name, dns.TypeToString[sig.TypeCovered])
+			}
+			sigs[sig.TypeCovered]++
+		}
+		for _, rrset := range rrsets {
+			if sigs[rrset[0].Header().Rrtype] != 1 {
+				t.Errorf("%s rrset has %d signatures, want 1", dns.TypeToString[rrset[0].Header().Rrtype], sigs[rrset[0].Header().Rrtype])
+			}
+		}
+	}
+
+	// signatures are cached, same rrset signed again give same signature
+	again := new(dns.Msg)
+	again.Answer = r.Resolve("all.example", dns.TypeA)
+	r.signReply(again)
+	first := reply.Answer[len(reply.Answer)-1].(*dns.RRSIG)
+	second := again.Answer[len(again.Answer)-1].(*dns.RRSIG)
+	if first.Signature != second.Signature {
+		t.Errorf("signature of same rrset has not been cached")
+	}
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// dnstap content type used in frame streams, see https://dnstap.info
+const dnstapContentType = "protobuf:dnstap.Dnstap"
+
+// frame streams control frames types and content type field
+const (
+	fstrmControlAccept      = 0x01
+	fstrmControlStart       = 0x02
+	fstrmControlStop        = 0x03
+	fstrmControlReady       = 0x04
+	fstrmControlFinish      = 0x05
+	fstrmControlContentType = 0x01
+)
+
+// dnstap protobuf values, see dnstap.proto
+const (
+	dnstapTypeMessage           = 1
+	dnstapMessageClientQuery    = 5
+	dnstapMessageClientResponse = 6
+	dnstapSocketFamilyInet      = 1
+	dnstapSocketFamilyInet6     = 2
+	dnstapSocketProtocolUDP     = 1
+	dnstapSocketProtocolTCP     = 2
+	dnstapSocketProtocolDOT     = 3
+	dnstapSocketProtocolDOH     = 4
+)
+
+const (
+	dnstapReconnectInterval = 5 * time.Second
+	dnstapCloseTimeout      = 5 * time.Second
+	dnstapSocketTimeout     = 5 * time.Second
+)
+
+// dnstapWriter send client query and client response dnstap messages of each query served
+// to a unix socket or a file with frame streams protocol.
+// Messages are written in background and dropped when buffer is full to never slow down dns answers.
+type dnstapWriter struct {
+	config *models.DNSTapConfig
+	frames chan []byte
+	mutex  sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func newDnstapWriter(config *models.DNSTapConfig) *dnstapWriter {
+	w := &dnstapWriter{
+		config: config,
+		frames: make(chan []byte, config.BufferSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *dnstapWriter) QueryServed(info *QueryInfo) {
+	query, err := info.Request.Pack()
+	if err != nil {
+		log.Errorf("error when packing query for dnstap: %s", err.Error())
+		return
+	}
+	response, err := info.Response.Pack()
+	if err != nil {
+		log.Errorf("error when packing response for dnstap: %s", err.Error())
+		return
+	}
+	w.send(w.dnstapFrame(dnstapMessageClientQuery, info, query, nil))
+	w.send(w.dnstapFrame(dnstapMessageClientResponse, info, query, response))
+}
+
+func (w *dnstapWriter) QueryDropped(string) {}
+
+func (w *dnstapWriter) QueryForwarded() {}
+
+func (w *dnstapWriter) UpstreamFailure(string) {}
+
+func (w *dnstapWriter) send(frame []byte) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.frames <- frame:
+	default:
+		log.Debug("dnstap buffer is full, message dropped")
+	}
+}
+
+// Close stop writing, messages already buffered are written before closing output
+func (w *dnstapWriter) Close() {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.frames)
+	w.mutex.Unlock()
+	select {
+	case <-w.done:
+	case <-time.After(dnstapCloseTimeout):
+		log.Warn("timeout when closing dnstap output")
+	}
+}
+
+func (w *dnstapWriter) run() {
+	defer close(w.done)
+	for {
+		out, err := w.open()
+		if err != nil {
+			log.Warnf("dnstap output could not be opened, retrying in %s: %s", dnstapReconnectInterval, err.Error())
+			if w.waitReconnect() {
+				return
+			}
+			continue
+		}
+		err = w.writeFrames(out)
+		if err != nil {
+			// stop stream anyway so frames already written can be read up to the error
+			_ = writeControlFrame(out, fstrmControlStop)
+		}
+		_ = out.Close()
+		if err == nil {
+			return
+		}
+		log.Warnf("error when writing dnstap messages, reopening output: %s", err.Error())
+	}
+}
+
+// waitReconnect wait before opening again output, messages sent meanwhile are dropped,
+// true is returned when writer has been closed
+func (w *dnstapWriter) waitReconnect() bool {
+	timer := time.NewTimer(dnstapReconnectInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-w.frames:
+			if !ok {
+				return true
+			}
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// open output and start frame stream, a bidirectional handshake is made on unix socket.
+// A file holds only one frame stream as readers stop at first stop frame,
+// an existing file is rotated to not lose messages already written when output is reopened
+func (w *dnstapWriter) open() (io.ReadWriteCloser, error) {
+	if w.config.File != "" {
+		err := rotateDnstapFile(w.config.File)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(w.config.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		err = writeControlFrame(f, fstrmControlStart)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+	conn, err := net.DialTimeout("unix", w.config.Socket, dnstapSocketTimeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(dnstapSocketTimeout))
+	err = writeControlFrame(conn, fstrmControlReady)
+	if err == nil {
+		err = readControlFrame(conn, fstrmControlAccept)
+	}
+	if err == nil {
+		err = writeControlFrame(conn, fstrmControlStart)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// rotateDnstapFile rename a non empty dnstap file with current time as suffix
+func rotateDnstapFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	return os.Rename(path, path+"."+time.Now().Format("20060102T150405.000000000"))
+}
+
+// writeFrames write messages until writer is closed, nil is returned when stream has been stopped
+func (w *dnstapWriter) writeFrames(out io.ReadWriter) error {
+	buf := bufio.NewWriter(out)
+	for frame := range w.frames {
+		_, err := buf.Write(appendUint32(nil, uint32(len(frame))))
+		if err != nil {
+			return err
+		}
+		_, err = buf.Write(frame)
+		if err != nil {
+			return err
+		}
+		// flush when there is no more message waiting to not keep messages in buffer
+		if len(w.frames) == 0 {
+			err = buf.Flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := buf.Flush()
+	if err != nil {
+		return err
+	}
+	err = writeControlFrame(out, fstrmControlStop)
+	if err != nil {
+		return err
+	}
+	if w.config.Socket != "" {
+		if conn, ok := out.(net.Conn); ok {
+			_ = conn.SetReadDeadline(time.Now().Add(dnstapSocketTimeout))
+		}
+		return readControlFrame(out, fstrmControlFinish)
+	}
+	return nil
+}
+
+// writeControlFrame write a frame streams control frame, content type is set on all frames except stop and finish
+func writeControlFrame(out io.Writer, controlType uint32) error {
+	payload := appendUint32(nil, controlType)
+	if controlType != fstrmControlStop && controlType != fstrmControlFinish {
+		payload = appendUint32(payload, fstrmControlContentType)
+		payload = appendUint32(payload, uint32(len(dnstapContentType)))
+		payload = append(payload, dnstapContentType...)
+	}
+	// control frames start with an escape sequence (a zero length data frame) followed by control frame length
+	frame := appendUint32(nil, 0)
+	frame = appendUint32(frame, uint32(len(payload)))
+	_, err := out.Write(append(frame, payload...))
+	return err
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	return append(b, buf...)
+}
+
+func readControlFrame(in io.Reader, expectedType uint32) error {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(in, header)
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(header[:4]) != 0 {
+		return fmt.Errorf("expected frame streams control frame")
+	}
+	length := binary.BigEndian.Uint32(header[4:])
+	if length < 4 || length > 512 {
+		return fmt.Errorf("invalid frame streams control frame length %d", length)
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(in, payload)
+	if err != nil {
+		return err
+	}
+	if controlType := binary.BigEndian.Uint32(payload[:4]); controlType != expectedType {
+		return fmt.Errorf("expected frame streams control frame of type %d, got %d", expectedType, controlType)
+	}
+	return nil
+}
+
+// dnstapFrame encode a dnstap message in protobuf, response is nil for query message
+func (w *dnstapWriter) dnstapFrame(messageType int, info *QueryInfo, query, response []byte) []byte {
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, uint64(messageType))
+	family := uint64(dnstapSocketFamilyInet)
+	if info.ClientIP != nil && info.ClientIP.To4() == nil {
+		family = dnstapSocketFamilyInet6
+	}
+	msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, family)
+	msg = protowire.AppendTag(msg, 3, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, dnstapSocketProtocol(info.Transport))
+	if clientIP := dnstapIP(info.ClientIP); clientIP != nil {
+		msg = protowire.AppendTag(msg, 4, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, clientIP)
+	}
+	if serverIP := dnstapIP(info.ServerIP); serverIP != nil {
+		msg = protowire.AppendTag(msg, 5, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, serverIP)
+	}
+	msg = protowire.AppendTag(msg, 6, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, uint64(info.ClientPort))
+	msg = protowire.AppendTag(msg, 7, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, uint64(info.ServerPort))
+	msg = protowire.AppendTag(msg, 8, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, uint64(info.Time.Unix()))
+	msg = protowire.AppendTag(msg, 9, protowire.Fixed32Type)
+	msg = protowire.AppendFixed32(msg, uint32(info.Time.Nanosecond()))
+	msg = protowire.AppendTag(msg, 10, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, query)
+	if response != nil {
+		responseTime := info.Time.Add(info.Duration)
+		msg = protowire.AppendTag(msg, 12, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(responseTime.Unix()))
+		msg = protowire.AppendTag(msg, 13, protowire.Fixed32Type)
+		msg = protowire.AppendFixed32(msg, uint32(responseTime.Nanosecond()))
+		msg = protowire.AppendTag(msg, 14, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, response)
+	}
+
+	var frame []byte
+	frame = protowire.AppendTag(frame, 1, protowire.BytesType)
+	frame = protowire.AppendBytes(frame, []byte(w.config.Identity))
+	frame = protowire.AppendTag(frame, 2, protowire.BytesType)
+	frame = protowire.AppendBytes(frame, []byte(w.config.Version))
+	frame = protowire.AppendTag(frame, 14, protowire.BytesType)
+	frame = protowire.AppendBytes(frame, msg)
+	frame = protowire.AppendTag(frame, 15, protowire.VarintType)
+	frame = protowire.AppendVarint(frame, dnstapTypeMessage)
+	return frame
+}
+
+func dnstapSocketProtocol(transport string) uint64 {
+	switch transport {
+	case TransportUDP:
+		return dnstapSocketProtocolUDP
+	case TransportTLS:
+		return dnstapSocketProtocolDOT
+	case TransportHTTPS:
+		return dnstapSocketProtocolDOH
+	}
+	return dnstapSocketProtocolTCP
+}
+
+// dnstapIP give ip in 4 bytes for ipv4 and 16 bytes for ipv6 as expected in dnstap messages
+func dnstapIP(ip net.IP) []byte {
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// readFrameStream give control frame types and data frames of a frame stream, data frames are given as "data"
+func readFrameStream(t *testing.T, path string) []string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := make([]string, 0)
+	for len(content) >= 4 {
+		length := binary.BigEndian.Uint32(content)
+		content = content[4:]
+		if length != 0 {
+			frames = append(frames, "data")
+			content = content[length:]
+			continue
+		}
+		length = binary.BigEndian.Uint32(content)
+		switch binary.BigEndian.Uint32(content[4:]) {
+		case fstrmControlStart:
+			frames = append(frames, "start")
+		case fstrmControlStop:
+			frames = append(frames, "stop")
+		}
+		content = content[4+length:]
+	}
+	return frames
+}
+
+func TestDnstapFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.log")
+	config := &models.DNSTapConfig{File: path, BufferSize: 10}
+
+	w := newDnstapWriter(config)
+	w.send([]byte("first"))
+	w.Close()
+	w = newDnstapWriter(config)
+	w.send([]byte("second"))
+	w.send([]byte("third"))
+	w.Close()
+
+	// each file must hold exactly one frame stream
+	if frames := readFrameStream(t, path); !reflect.DeepEqual(frames, []string{"start", "data", "data", "stop"}) {
+		t.Errorf("unexpected frames in dnstap file: %v", frames)
+	}
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 1 {
+		t.Fatalf("previous dnstap file must have been rotated, found %v", rotated)
+	}
+	if frames := readFrameStream(t, rotated[0]); !reflect.DeepEqual(frames, []string{"start", "data", "stop"}) {
+		t.Errorf("unexpected frames in rotated dnstap file: %v", frames)
+	}
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"github.com/miekg/dns"
+)
+
+// setReplyEdns0 set our own OPT record in reply if client sent one and give the maximum size
+// to use for answering in udp, size is the minimum between client advertised size and server max size.
+// False is returned when client use an unsupported edns version, reply has been set with BADVERS rcode.
+func (r *Resolver) setReplyEdns0(req *dns.Msg, reply *dns.Msg) (int, bool) {
+	opt := req.IsEdns0()
+	if opt == nil {
+		return dns.MinMsgSize, true
+	}
+	reply.SetEdns0(r.maxUDPSize, opt.Do())
+	if opt.Version() != 0 {
+		reply.Rcode = dns.RcodeBadVers
+		return dns.MinMsgSize, false
+	}
+	udpSize := int(opt.UDPSize())
+	if udpSize > int(r.maxUDPSize) {
+		udpSize = int(r.maxUDPSize)
+	}
+	if udpSize < dns.MinMsgSize {
+		udpSize = dns.MinMsgSize
+	}
+	return udpSize, true
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"time"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// entryStatus give refresh status of an entry, status is stored by value and replaced on each update
+// so it can be read while entry is refreshed
+func (r *Resolver) entryStatus(domain string) models.EntryStatus {
+	status, ok := r.entriesStatus.Load(domain)
+	if !ok {
+		return models.EntryStatus{Domain: domain}
+	}
+	return status.(models.EntryStatus)
+}
+
+// updateEntryStatus record an attempt to refresh entry started at start, previous status is given
+func (r *Resolver) updateEntryStatus(domain string, start time.Time, nbDevices int, err error) models.EntryStatus {
+	previous := r.entryStatus(domain)
+	status := previous
+	status.LastAttempt = &start
+	status.RefreshDuration = time.Since(start).Seconds()
+	status.Stale = err != nil
+	if err != nil {
+		status.LastError = err.Error()
+	} else {
+		status.LastSuccess = &start
+		status.LastError = ""
+		status.DeviceCount = nbDevices
+	}
+	r.entriesStatus.Store(domain, status)
+	return previous
+}
+
+// EntryStatus give refresh status of an entry, false is returned if domain is not an entry loaded from netdisco
+func (r *Resolver) EntryStatus(domain string) (models.EntryStatus, bool) {
+	entry := r.entries.FindByDomain(domain)
+	if entry == nil || entry.IsAlias() {
+		return models.EntryStatus{}, false
+	}
+	return r.entryStatus(entry.Domain), true
+}
+
+// EntriesStatus give refresh status of all entries loaded from netdisco
+func (r *Resolver) EntriesStatus() []models.EntryStatus {
+	statuses := make([]models.EntryStatus, 0, len(r.entries))
+	for _, e := range r.entries {
+		if e.IsAlias() {
+			continue
+		}
+		statuses = append(statuses, r.entryStatus(e.Domain))
+	}
+	return statuses
+}
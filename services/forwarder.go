@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+type forwarder struct {
+	upstreams []string
+	udpClient *dns.Client
+	tcpClient *dns.Client
+	onFailure func(upstream string)
+}
+
+func newForwarder(upstreams []string, timeout time.Duration, onFailure func(upstream string)) *forwarder {
+	return &forwarder{
+		upstreams: upstreams,
+		udpClient: &dns.Client{Net: "udp", Timeout: timeout},
+		tcpClient: &dns.Client{Net: "tcp", Timeout: timeout},
+		onFailure: onFailure,
+	}
+}
+
+// Forward send request to upstreams in order until one answer,
+// answer truncated in udp by an upstream are retried in tcp on the same upstream
+func (f *forwarder) Forward(req *dns.Msg) (*dns.Msg, error) {
+	var lastErr error
+	for _, upstream := range f.upstreams {
+		resp, _, err := f.udpClient.Exchange(req, upstream)
+		if err == nil && resp.Truncated {
+			resp, _, err = f.tcpClient.Exchange(req, upstream)
+		}
+		if err != nil {
+			log.WithField("upstream", upstream).Warnf("error when forwarding dns request: %s", err.Error())
+			lastErr = err
+			f.onFailure(upstream)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("no upstream could answer: %v", lastErr)
+}
+
+// isLocalName check if a name must be answered by us and not forwarded,
+// local names are names in zones, entries domains (and their sub-domains), netdisco suffixes
+// and reverse names of devices we know
+func (r *Resolver) isLocalName(name string) bool {
+	if r.findZone(name) != nil {
+		return true
+	}
+	domain := strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, e := range r.entries {
+		entryDomain := strings.ToLower(e.Domain)
+		if domain == entryDomain || strings.HasSuffix(domain, "."+entryDomain) {
+			return true
+		}
+	}
+	for _, suffix := range r.netdiscoSuffixes {
+		suffix = strings.ToLower(strings.Trim(suffix, "."))
+		if domain == suffix || strings.HasSuffix(domain, "."+suffix) {
+			return true
+		}
+	}
+	if IsReverseName(domain) {
+		ip := ReverseNameToIP(domain)
+		if ip == nil {
+			return false
+		}
+		_, _, known := r.cachedDevicesByIP(ip, nil)
+		return known
+	}
+	return false
+}
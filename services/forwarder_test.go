@@ -0,0 +1,37 @@
+package services
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestForwarderFailures(t *testing.T) {
+	// udp ports which have been closed, nothing answer on them
+	closedAddrs := make([]string, 0)
+	for i := 0; i < 2; i++ {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		closedAddrs = append(closedAddrs, conn.LocalAddr().String())
+		conn.Close()
+	}
+	failures := make([]string, 0)
+	f := newForwarder(closedAddrs, 200*time.Millisecond, func(upstream string) {
+		failures = append(failures, upstream)
+	})
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	_, err := f.Forward(req)
+	if err == nil {
+		t.Fatal("forward must fail when no upstream answer")
+	}
+	// failure of last upstream is counted too
+	if !reflect.DeepEqual(failures, closedAddrs) {
+		t.Errorf("failures reported for %v, want %v", failures, closedAddrs)
+	}
+}
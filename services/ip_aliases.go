@@ -0,0 +1,74 @@
+package services
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/orange-cloudfoundry/go-netdisco"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// withIPAliases add to devices a copy of each device for every other address of device matching ip aliases config,
+// copies have this address as ip so they are served like any device.
+// Addresses of devices are retrieved with at most as many concurrent requests as workers for all entries,
+// addresses retrieved at previous refresh of entry are used for a device whose addresses could not be retrieved
+// to not change zone on transient netdisco errors
+func (r *Resolver) withIPAliases(entry *models.Entry, devices []netdisco.Device) []netdisco.Device {
+	previousAddresses := make(map[string][]models.DeviceAddress)
+	if previous, ok := r.entriesAddresses.Load(entry.Domain); ok {
+		previousAddresses = previous.(map[string][]models.DeviceAddress)
+	}
+	devicesAddresses := make([][]models.DeviceAddress, len(devices))
+	wg := &sync.WaitGroup{}
+	for i, device := range devices {
+		if device.IP == "" {
+			continue
+		}
+		wg.Add(1)
+		r.addressesSem <- struct{}{}
+		go func(i int, device netdisco.Device) {
+			defer wg.Done()
+			defer func() { <-r.addressesSem }()
+			addresses, err := r.deviceAddresses(device.IP)
+			if err != nil {
+				log.WithField("entry_domain", entry.Domain).WithField("device", device.IP).
+					Warnf("ip aliases of device could not be retrieved, previous ones are kept: %s", err.Error())
+				addresses = previousAddresses[device.IP]
+			}
+			devicesAddresses[i] = addresses
+		}(i, device)
+	}
+	wg.Wait()
+
+	entryAddresses := make(map[string][]models.DeviceAddress)
+	allDevices := make([]netdisco.Device, 0, len(devices))
+	for i, device := range devices {
+		allDevices = append(allDevices, device)
+		if devicesAddresses[i] == nil {
+			continue
+		}
+		entryAddresses[device.IP] = devicesAddresses[i]
+		for _, address := range devicesAddresses[i] {
+			if address.Alias == device.IP || !entry.IPAliases.Match(address) {
+				continue
+			}
+			aliasDevice := device
+			aliasDevice.IP = address.Alias
+			allDevices = append(allDevices, aliasDevice)
+		}
+	}
+	r.entriesAddresses.Store(entry.Domain, entryAddresses)
+	return r.filterDuplicateDevices(allDevices)
+}
+
+// deviceAddresses give all ip addresses set on a device from netdisco
+func (r *Resolver) deviceAddresses(ip string) ([]models.DeviceAddress, error) {
+	addresses := make([]models.DeviceAddress, 0)
+	err := r.nClient.Do(http.MethodGet, "/api/v1/object/device/"+ip+"/device_ips", nil, &addresses)
+	if err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
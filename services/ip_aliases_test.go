@@ -0,0 +1,49 @@
+package services
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestIPAliases(t *testing.T) {
+	r := newTestResolver(t, `
+netdisco: {endpoint: http://netdisco}
+dns_server:
+  zones:
+  - name: example
+    ns: [ns1.example]
+entries:
+- domain: all.example
+  ip_aliases: {enable: true}
+  targets: [{q: '%'}]
+`)
+	expectedIPs := map[string]bool{"10.0.0.1": true, "10.255.0.1": true, "10.0.0.2": true}
+	checkIPs := func(step string) {
+		rrs := r.Resolve("all.example", dns.TypeA)
+		if len(rrs) != len(expectedIPs) {
+			t.Errorf("%s: expected %d a records, got %d", step, len(expectedIPs), len(rrs))
+		}
+		for _, rr := range rrs {
+			if !expectedIPs[rr.(*dns.A).A.String()] {
+				t.Errorf("%s: unexpected a record %s", step, rr)
+			}
+		}
+	}
+	checkIPs("addresses retrieved")
+	status, _ := r.EntryStatus("all.example")
+	if status.DeviceCount != len(testDevices) {
+		t.Errorf("device count is %d, aliases must not be counted", status.DeviceCount)
+	}
+
+	// transient errors keep previous aliases and zone unchanged
+	serial := r.Serial()
+	atomic.StoreInt32(&testAddressesDown, 1)
+	defer atomic.StoreInt32(&testAddressesDown, 0)
+	r.dispatchWorker()
+	checkIPs("addresses api down")
+	if r.Serial() != serial {
+		t.Errorf("serial changed on ip aliases retrieval error")
+	}
+}
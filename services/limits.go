@@ -0,0 +1,164 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+const (
+	DropReasonACL       = "acl"
+	DropReasonRateLimit = "rate_limit"
+	DropReasonRRL       = "rrl"
+)
+
+// purgeLimiterInterval is the minimum interval between two removals of idle buckets in a rate limiter
+const purgeLimiterInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket rate limiter by key,
+// buckets which are full again are removed regularly to not keep keys of all clients ever seen
+type rateLimiter struct {
+	mutex     sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastPurge time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastPurge: time.Now(),
+	}
+}
+
+// Allow take a token in bucket of key, false is returned when bucket is empty
+func (l *rateLimiter) Allow(key string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if now.Sub(l.lastPurge) > purgeLimiterInterval {
+		l.purge(now)
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (l *rateLimiter) purge(now time.Time) {
+	l.lastPurge = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// queryLimits apply access control, queries rate limit and responses rate limit configured on dns server
+type queryLimits struct {
+	acl             *models.AccessControl
+	rateLimit       *models.RateLimit
+	queryLimiter    *rateLimiter
+	rrl             *models.ResponseRateLimit
+	responseLimiter *rateLimiter
+}
+
+func newQueryLimits(dnsConfig *models.DNSServerConfig) *queryLimits {
+	l := &queryLimits{
+		acl: dnsConfig.ACL,
+	}
+	if dnsConfig.RateLimit != nil && dnsConfig.RateLimit.QueriesPerSecond > 0 {
+		l.rateLimit = dnsConfig.RateLimit
+		l.queryLimiter = newRateLimiter(dnsConfig.RateLimit.QueriesPerSecond, dnsConfig.RateLimit.Burst)
+	}
+	if dnsConfig.RRL != nil && dnsConfig.RRL.ResponsesPerSecond > 0 {
+		l.rrl = dnsConfig.RRL
+		l.responseLimiter = newRateLimiter(dnsConfig.RRL.ResponsesPerSecond, dnsConfig.RRL.Burst)
+	}
+	return l
+}
+
+// admitQuery give the reason for which query from client must be refused, empty string is returned if query is admitted
+func (l *queryLimits) admitQuery(clientIP net.IP) string {
+	if !l.acl.Allowed(clientIP) {
+		return DropReasonACL
+	}
+	if l.queryLimiter == nil || clientIP == nil || l.rateLimit.Exempt.Contains(clientIP) {
+		return ""
+	}
+	if !l.queryLimiter.Allow(clientIP.String(), time.Now()) {
+		return DropReasonRateLimit
+	}
+	return ""
+}
+
+// admitResponse check if response can be sent to client network without exceeding responses rate limit
+func (l *queryLimits) admitResponse(clientIP net.IP, reply *dns.Msg) bool {
+	if l.responseLimiter == nil || clientIP == nil || l.rrl.Exempt.Contains(clientIP) {
+		return true
+	}
+	return l.responseLimiter.Allow(l.responseKey(clientIP, reply), time.Now())
+}
+
+// responseKey identify a response sent to a client network by name, type and rcode
+func (l *queryLimits) responseKey(clientIP net.IP, reply *dns.Msg) string {
+	var network net.IP
+	if ip4 := clientIP.To4(); ip4 != nil {
+		network = ip4.Mask(net.CIDRMask(l.rrl.IPv4PrefixLength, 8*net.IPv4len))
+	} else {
+		network = clientIP.Mask(net.CIDRMask(l.rrl.IPv6PrefixLength, 8*net.IPv6len))
+	}
+	qname, qtype := "", uint16(0)
+	if len(reply.Question) > 0 {
+		qname, qtype = strings.ToLower(reply.Question[0].Name), reply.Question[0].Qtype
+	}
+	return fmt.Sprintf("%s/%s/%d/%d", network, qname, qtype, reply.Rcode)
+}
+
+// writeReply send reply to client if responses rate limit allow it, REFUSED is sent instead otherwise
+func (r *Resolver) writeReply(w dns.ResponseWriter, req *dns.Msg, reply *dns.Msg, clientIP net.IP) {
+	if !r.limits.admitResponse(clientIP, reply) {
+		r.refuse(w, req, DropReasonRRL)
+		return
+	}
+	err := w.WriteMsg(reply)
+	if err != nil {
+		log.Errorf("error writing dns response: %s", err.Error())
+	}
+}
+
+// refuse answer REFUSED to request dropped for reason
+func (r *Resolver) refuse(w dns.ResponseWriter, req *dns.Msg, reason string) {
+	r.observers.QueryDropped(reason)
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeRefused)
+	err := w.WriteMsg(m)
+	if err != nil {
+		log.Errorf("error writing dns response: %s", err.Error())
+	}
+}
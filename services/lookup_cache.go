@@ -0,0 +1,88 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/orange-cloudfoundry/go-netdisco"
+)
+
+type lookupCacheItem struct {
+	key        string
+	devices    []netdisco.Device
+	expireWhen time.Time
+}
+
+// lookupCache is a bounded lru cache of devices searched in netdisco for names which are not in entries,
+// least recently used names are evicted when cache is full
+type lookupCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	items      map[string]*list.Element
+	lru        *list.List
+}
+
+func newLookupCache(maxEntries int) *lookupCache {
+	return &lookupCache{
+		maxEntries: maxEntries,
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get give devices cached for key, second return is false when key is not cached or has expired
+func (c *lookupCache) Get(key string, now time.Time) ([]netdisco.Device, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*lookupCacheItem)
+	if !now.Before(item.expireWhen) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return item.devices, true
+}
+
+func (c *lookupCache) Set(key string, devices []netdisco.Device, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expireWhen := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		item := elem.Value.(*lookupCacheItem)
+		item.devices = devices
+		item.expireWhen = expireWhen
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&lookupCacheItem{
+		key:        key,
+		devices:    devices,
+		expireWhen: expireWhen,
+	})
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// PurgeExpired remove all expired names
+func (c *lookupCache) PurgeExpired(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for elem := c.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if !now.Before(elem.Value.(*lookupCacheItem).expireWhen) {
+			c.remove(elem)
+		}
+		elem = prev
+	}
+}
+
+func (c *lookupCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.items, elem.Value.(*lookupCacheItem).key)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/miekg/dns"
+	"github.com/orange-cloudfoundry/go-netdisco"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// devicesFingerprint give a hash of device information used in records,
+// it let us know when the stored device list change without being disturbed by counters like uptime
+func devicesFingerprint(devices []netdisco.Device) uint64 {
+	keys := make([]string, len(devices))
+	for i, d := range devices {
+		keys[i] = d.IP + "$" + d.DNS + "$" + d.Name + "$" + d.Serial + "$" + d.Mac + "$" +
+			d.Vendor + "$" + d.Model + "$" + d.Os + "$" + d.OsVer + "$" + d.Location
+	}
+	sort.Strings(keys)
+	xxh := xxhash.New()
+	for _, key := range keys {
+		xxh.WriteString(key)                    // nolint
+		xxh.Write([]byte{models.SeparatorByte}) // nolint
+	}
+	return xxh.Sum64()
+}
+
+// notifySecondaries send a dns NOTIFY for all zones to all configured secondaries
+func (r *Resolver) notifySecondaries() {
+	if len(r.notifyTargets) == 0 {
+		return
+	}
+	client := &dns.Client{Net: "udp", Timeout: 2 * time.Second}
+	for _, zone := range r.zones {
+		if zone.Signed() {
+			// signed zones can't be transferred
+			continue
+		}
+		m := new(dns.Msg)
+		m.SetNotify(zone.Name)
+		m.Answer = []dns.RR{r.zoneSOA(zone)}
+		for _, target := range r.notifyTargets {
+			entry := log.WithField("zone", zone.Name).WithField("secondary", target)
+			resp, _, err := client.Exchange(m, target)
+			if err != nil {
+				entry.Errorf("error when sending notify: %s", err.Error())
+				continue
+			}
+			if resp.Rcode != dns.RcodeSuccess {
+				entry.Warnf("notify answered with rcode %s", dns.RcodeToString[resp.Rcode])
+				continue
+			}
+			entry.WithField("serial", r.Serial()).Debug("notify sent")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	TransportUDP   = "udp"
+	TransportTCP   = "tcp"
+	TransportTLS   = "tls"
+	TransportHTTPS = "https"
+)
+
+// QueryInfo describe a query served by dns handler
+type QueryInfo struct {
+	Transport  string
+	ClientIP   net.IP
+	ClientPort int
+	ServerIP   net.IP
+	ServerPort int
+	// Time is when query has been received
+	Time     time.Time
+	Request  *dns.Msg
+	Response *dns.Msg
+	// EntryDomain is domain of entry serving question name, it is empty for names outside entries
+	EntryDomain  string
+	ResponseSize int
+	Duration     time.Duration
+}
+
+// DNSObserver is notified of dns server activity, it lets metrics be collected without making services depend on them
+type DNSObserver interface {
+	// QueryServed is called after each response sent by dns handler
+	QueryServed(info *QueryInfo)
+	// QueryDropped is called when a query is refused because of access control or rate limits
+	QueryDropped(reason string)
+	// QueryForwarded is called for each query forwarded to upstreams
+	QueryForwarded()
+	// UpstreamFailure is called each time forwarding a query to an upstream failed, next upstream is tried if any
+	UpstreamFailure(upstream string)
+}
+
+// dnsObservers notify all its observers
+type dnsObservers []DNSObserver
+
+func (os dnsObservers) QueryServed(info *QueryInfo) {
+	for _, o := range os {
+		o.QueryServed(info)
+	}
+}
+
+func (os dnsObservers) QueryDropped(reason string) {
+	for _, o := range os {
+		o.QueryDropped(reason)
+	}
+}
+
+func (os dnsObservers) QueryForwarded() {
+	for _, o := range os {
+		o.QueryForwarded()
+	}
+}
+
+func (os dnsObservers) UpstreamFailure(upstream string) {
+	for _, o := range os {
+		o.UpstreamFailure(upstream)
+	}
+}
+
+// AddDNSObserver add an observer notified of dns server activity, it must be called before serving dns
+func (r *Resolver) AddDNSObserver(observer DNSObserver) {
+	r.observers = append(r.observers, observer)
+}
+
+// observedWriter keep last message written by dns handler to report it to observer
+type observedWriter struct {
+	dns.ResponseWriter
+	reply *dns.Msg
+}
+
+func (w *observedWriter) WriteMsg(m *dns.Msg) error {
+	w.reply = m
+	return w.ResponseWriter.WriteMsg(m)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// queryLogger log each query served with its result as structured fields
+type queryLogger struct{}
+
+func (queryLogger) QueryServed(info *QueryInfo) {
+	entry := log.WithFields(log.Fields{
+		"client":      info.ClientIP.String(),
+		"transport":   info.Transport,
+		"rcode":       dns.RcodeToString[info.Response.Rcode],
+		"answers":     len(info.Response.Answer),
+		"size":        info.ResponseSize,
+		"duration_ms": float64(info.Duration.Microseconds()) / 1000,
+	})
+	if len(info.Request.Question) > 0 {
+		entry = entry.WithFields(log.Fields{
+			"name": info.Request.Question[0].Name,
+			"type": dns.TypeToString[info.Request.Question[0].Qtype],
+		})
+	}
+	if info.EntryDomain != "" {
+		entry = entry.WithField("entry_domain", info.EntryDomain)
+	}
+	entry.Info("dns query")
+}
+
+// QueryDropped does nothing, refused queries are already logged when served
+func (queryLogger) QueryDropped(string) {}
+
+func (queryLogger) QueryForwarded() {}
+
+func (queryLogger) UpstreamFailure(string) {}
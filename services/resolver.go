@@ -2,44 +2,109 @@ package services
 
 import (
 	"context"
+	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/orange-cloudfoundry/go-netdisco"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/orange-cloudfoundry/netdisco-bridges/models"
 	"github.com/orange-cloudfoundry/netdisco-bridges/rtmakers"
 )
 
 type Resolver struct {
-	entries              models.Entries
-	nClient              *netdisco.Client
-	entriesCacheResolve  *sync.Map
-	netdiscoResolveCache *sync.Map
-	warmedUp             bool
-	warmupChan           chan bool
-	tickWorker           time.Duration
-	nbWorkers            int
+	entries             models.Entries
+	nClient             *netdisco.Client
+	entriesCacheResolve *sync.Map
+	lookupCache         *lookupCache
+	lookups             singleflight.Group
+	negativeTTL         time.Duration
+	warmedUp            chan struct{}
+	warmupOnce          sync.Once
+	refreshed           chan struct{}
+	refreshedOnce       sync.Once
+	tickWorker          time.Duration
+	nbWorkers           int
+	zones               []*models.DNSZone
+	serial              uint32
+	maxUDPSize          uint16
+	forwarder           *forwarder
+	netdiscoSuffixes    []string
+	transferAllowed     models.CIDRs
+	notifyTargets       []string
+	devicesChanged      int32
+	entriesLoaded       int32
+	cacheFile           string
+	entriesStatus       *sync.Map
+	entriesAddresses    *sync.Map
+	addressesSem        chan struct{}
+	answerPolicies      *answerPolicies
+	views               models.Views
+	limits              *queryLimits
+	observers           dnsObservers
+	dnstap              *dnstapWriter
+	signatures          *signatureCache
 }
 
-type netdiscoResolved struct {
-	Devices    []netdisco.Device
-	ExpireWhen time.Time
-}
-
-func NewResolver(entries models.Entries, nClient *netdisco.Client, nbWorkers int, tickWorker time.Duration) *Resolver {
-	return &Resolver{
-		entries:              entries,
-		nClient:              nClient,
-		entriesCacheResolve:  &sync.Map{},
-		netdiscoResolveCache: &sync.Map{},
-		tickWorker:           tickWorker,
-		nbWorkers:            nbWorkers,
-		warmupChan:           make(chan bool, 1),
-	}
+func NewResolver(
+	entries models.Entries,
+	nClient *netdisco.Client,
+	nbWorkers int,
+	tickWorker time.Duration,
+	cacheFile string,
+	lookupConfig *models.LookupCacheConfig,
+	dnsConfig *models.DNSServerConfig,
+) *Resolver {
+	r := &Resolver{
+		entries:             entries,
+		nClient:             nClient,
+		entriesCacheResolve: &sync.Map{},
+		lookupCache:         newLookupCache(lookupConfig.MaxEntries),
+		negativeTTL:         time.Duration(lookupConfig.NegativeTTL),
+		tickWorker:          tickWorker,
+		cacheFile:           cacheFile,
+		entriesStatus:       &sync.Map{},
+		entriesAddresses:    &sync.Map{},
+		addressesSem:        make(chan struct{}, nbWorkers),
+		nbWorkers:           nbWorkers,
+		warmedUp:            make(chan struct{}),
+		refreshed:           make(chan struct{}),
+		zones:               dnsConfig.Zones,
+		serial:              uint32(time.Now().Unix()),
+		maxUDPSize:          dnsConfig.MaxUDPSize,
+		answerPolicies:      newAnswerPolicies(),
+		views:               dnsConfig.Views,
+		limits:              newQueryLimits(dnsConfig),
+		observers:           make(dnsObservers, 0),
+		signatures:          newSignatureCache(),
+	}
+	if dnsConfig.Forwarder != nil && dnsConfig.Forwarder.Enable {
+		r.forwarder = newForwarder(
+			dnsConfig.Forwarder.Upstreams,
+			time.Duration(dnsConfig.Forwarder.Timeout),
+			func(upstream string) {
+				r.observers.UpstreamFailure(upstream)
+			},
+		)
+		r.netdiscoSuffixes = dnsConfig.Forwarder.NetdiscoSuffixes
+	}
+	if dnsConfig.Transfer != nil {
+		r.transferAllowed = dnsConfig.Transfer.Allow
+		r.notifyTargets = dnsConfig.Transfer.Notify
+	}
+	if dnsConfig.QueryLog {
+		r.AddDNSObserver(queryLogger{})
+	}
+	if dnsConfig.DNSTap != nil && dnsConfig.DNSTap.Enable {
+		r.dnstap = newDnstapWriter(dnsConfig.DNSTap)
+		r.AddDNSObserver(r.dnstap)
+	}
+	return r
 }
 
 func (r *Resolver) GetEntries() models.Entries {
@@ -69,79 +134,340 @@ func (r *Resolver) GetEntryRoutes(format string, domain string) (interface{}, er
 }
 
 func (r *Resolver) DevicesFromEntry(entry *models.Entry) []netdisco.Device {
+	if entry.IsAlias() {
+		return r.aliasDevices(entry)
+	}
 	rawMaterials, ok := r.entriesCacheResolve.Load(entry.Domain)
 	if !ok {
 		return r.resolveFromNetdisco(entry.Domain)
 	}
-	return rawMaterials.([]netdisco.Device)
+	return entry.FreshDevices(rawMaterials.([]netdisco.Device), time.Now())
 }
 
 func (r *Resolver) Resolve(domain string, queryType uint16) []dns.RR {
-	return DevicesToRRS(domain, r.ResolveDevices(domain), queryType)
+	return r.ResolveInView(domain, queryType, nil)
+}
+
+// ResolveInView resolve domain with only devices visible in view, all devices are visible when view is nil
+func (r *Resolver) ResolveInView(domain string, queryType uint16, view *models.View) []dns.RR {
+	return r.resolveChain(domain, queryType, view, 0)
+}
+
+// resolveChain resolve domain and follow cname of alias entries, depth is the number of cname already followed
+func (r *Resolver) resolveChain(domain string, queryType uint16, view *models.View, depth int) []dns.RR {
+	if entry := r.entries.FindByDomain(domain); entry.IsAlias() {
+		return r.resolveAlias(entry, domain, queryType, view, depth)
+	}
+	rrs := r.resolveRRs(domain, queryType, view)
+	return r.answerPolicies.Apply(r.entryForName(domain), strings.ToLower(domain), queryType, rrs)
+}
+
+// resolveRRs give all records owned by domain visible in view without applying answer policies,
+// alias entries only own their cname record
+func (r *Resolver) resolveRRs(domain string, queryType uint16, view *models.View) []dns.RR {
+	if entry := r.entries.FindByDomain(domain); entry.IsAlias() {
+		if queryType != dns.TypeCNAME {
+			return []dns.RR{}
+		}
+		return r.aliasCNAME(entry, domain, view)
+	}
+	if queryType == dns.TypePTR && IsReverseName(domain) {
+		return r.resolvePTR(domain, view)
+	}
+	service, proto, baseDomain := splitSRVName(domain)
+	if service != "" {
+		return r.resolveServiceSRV(domain, service, proto, baseDomain, queryType, view)
+	}
+	entry := r.entryForName(domain)
+	devices := view.FilterDevices(entry, r.ResolveDevices(domain))
+	return DevicesToRRS(entry, domain, devices, queryType)
+}
+
+// resolveServiceSRV answer for names in the form _<service>._<proto>.<domain> with srv records configured in entry
+func (r *Resolver) resolveServiceSRV(domain, service, proto, baseDomain string, queryType uint16, view *models.View) []dns.RR {
+	entry := r.entryForName(baseDomain)
+	srvRecords := entry.SRVRecordsFor(service, proto)
+	if queryType != dns.TypeSRV || entry == nil || len(srvRecords) == 0 {
+		return []dns.RR{}
+	}
+	return DevicesToSRV(entry, domain, view.FilterDevices(entry, r.ResolveDevices(baseDomain)), srvRecords)
+}
+
+// entryForName give the entry which serve this name either as entry domain or as a device name under entry domain,
+// nil is returned if name is not from an entry
+func (r *Resolver) entryForName(domain string) *models.Entry {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, e := range r.entries {
+		if domain == strings.ToLower(e.Domain) {
+			return e
+		}
+	}
+	for _, e := range r.entries {
+		if e.IsAlias() {
+			continue
+		}
+		entryDomain := strings.ToLower(e.Domain)
+		label := strings.TrimSuffix(domain, "."+entryDomain)
+		if label != domain && !strings.Contains(label, ".") {
+			return e
+		}
+	}
+	return nil
+}
+
+// resolvePTR answer reverse lookup from devices already loaded from entries,
+// if no device in entries has this ip we fallback on a netdisco ip search
+func (r *Resolver) resolvePTR(domain string, view *models.View) []dns.RR {
+	ip := ReverseNameToIP(domain)
+	if ip == nil {
+		return []dns.RR{}
+	}
+	devices, entry, known := r.cachedDevicesByIP(ip, view)
+	if !known {
+		devices = r.searchNetdiscoCached(domain, &netdisco.SearchDeviceQuery{
+			Ip:       ip.String(),
+			Matchall: false,
+		})
+	}
+	return DevicesToPTR(entry, domain, devices)
+}
+
+// cachedDevicesByIP give fresh devices visible in view from entries with this ip and the first entry giving them,
+// last return is true when ip is in entries even if devices are all stale or hidden by view
+func (r *Resolver) cachedDevicesByIP(ip net.IP, view *models.View) ([]netdisco.Device, *models.Entry, bool) {
+	devices := make([]netdisco.Device, 0)
+	var entry *models.Entry
+	known := false
+	for _, e := range r.entries {
+		rawMaterials, ok := r.entriesCacheResolve.Load(e.Domain)
+		if !ok {
+			continue
+		}
+		for _, device := range rawMaterials.([]netdisco.Device) {
+			if DeviceIP(device).Equal(ip) {
+				known = true
+				break
+			}
+		}
+		for _, device := range view.FilterDevices(e, r.DevicesFromEntry(e)) {
+			if !DeviceIP(device).Equal(ip) {
+				continue
+			}
+			if entry == nil {
+				entry = e
+			}
+			devices = append(devices, device)
+		}
+	}
+	return devices, entry, known
 }
 
 func (r *Resolver) ResolveDevices(domain string) []netdisco.Device {
 	if domain == "" {
 		return []netdisco.Device{}
 	}
-	rawMaterials, ok := r.entriesCacheResolve.Load(domain)
-	if !ok {
-		return r.resolveFromNetdisco(domain)
+	if entry := r.entries.FindByDomain(domain); entry.IsAlias() {
+		return r.aliasDevices(entry)
+	}
+	rawMaterials, ok := r.entriesCacheResolve.Load(strings.ToLower(strings.TrimSuffix(domain, ".")))
+	if ok {
+		return r.entryForName(domain).FreshDevices(rawMaterials.([]netdisco.Device), time.Now())
 	}
-	return rawMaterials.([]netdisco.Device)
+	if devices, ok := r.resolveDeviceLabel(domain); ok {
+		return devices
+	}
+	return r.resolveFromNetdisco(domain)
 }
 
-func (r *Resolver) resolveFromNetdisco(domain string) []netdisco.Device {
-	nrRaw, ok := r.netdiscoResolveCache.Load(domain)
-	if ok && nrRaw.(*netdiscoResolved).ExpireWhen.After(time.Now()) {
-		return nrRaw.(*netdiscoResolved).Devices
+// resolveDeviceLabel find devices targeted by a name in the form <device label>.<entry domain>,
+// second return is false when name is not under an entry domain
+func (r *Resolver) resolveDeviceLabel(domain string) ([]netdisco.Device, bool) {
+	domain = strings.ToLower(domain)
+	for _, e := range r.entries {
+		if e.IsAlias() {
+			continue
+		}
+		suffix := "." + strings.ToLower(e.Domain)
+		if !strings.HasSuffix(domain, suffix) {
+			continue
+		}
+		label := strings.TrimSuffix(domain, suffix)
+		if label == "" || strings.Contains(label, ".") {
+			continue
+		}
+		devices := make([]netdisco.Device, 0)
+		for _, device := range r.DevicesFromEntry(e) {
+			for _, deviceLabel := range e.LabelsForDevice(device) {
+				if deviceLabel == label {
+					devices = append(devices, device)
+					break
+				}
+			}
+		}
+		return devices, true
 	}
-	devices, err := r.nClient.SearchDevice(&netdisco.SearchDeviceQuery{
+	return nil, false
+}
+
+func (r *Resolver) resolveFromNetdisco(domain string) []netdisco.Device {
+	return r.searchNetdiscoCached(domain, &netdisco.SearchDeviceQuery{
 		DNS:      domain,
 		Matchall: false,
 	})
+}
+
+// searchNetdiscoCached search devices in netdisco, concurrent searches for the same domain are made only once.
+// Results are cached for refresh interval, or for negative ttl when no device has been found
+func (r *Resolver) searchNetdiscoCached(domain string, query *netdisco.SearchDeviceQuery) []netdisco.Device {
+	if devices, ok := r.lookupCache.Get(domain, time.Now()); ok {
+		return devices
+	}
+	devices, err, _ := r.lookups.Do(domain, func() (interface{}, error) {
+		devices, err := r.nClient.SearchDevice(query)
+		if err != nil {
+			return nil, err
+		}
+		ttl := r.tickWorker
+		if len(devices) == 0 {
+			ttl = r.negativeTTL
+		}
+		r.lookupCache.Set(domain, devices, ttl)
+		return devices, nil
+	})
 	if err != nil {
 		log.Errorf("error when searching on netdisco dns entry: %s", err.Error())
 		return nil
 	}
-	r.netdiscoResolveCache.Store(domain, &netdiscoResolved{
-		Devices:    devices,
-		ExpireWhen: time.Now().Add(r.tickWorker),
-	})
-	return devices
+	return devices.([]netdisco.Device)
 }
 
-func (r *Resolver) MakeDNSHandler(inUdp bool) dns.Handler {
+// MakeDNSHandler give dns handler for a transport (one of TransportUDP, TransportTCP, TransportTLS or TransportHTTPS),
+// every response sent is reported to dns observer
+func (r *Resolver) MakeDNSHandler(transport string) dns.Handler {
+	inUdp := transport == TransportUDP
 	return dns.HandlerFunc(func(w dns.ResponseWriter, msg *dns.Msg) {
-		m := new(dns.Msg)
-		m.SetReply(msg)
-		m.Compress = true
-		rrs := make([]dns.RR, 0)
-		log.Debugf("receive request for with question: \n %s", msg.String())
-
-		for _, question := range msg.Question {
-			domain := strings.TrimSuffix(question.Name, ".")
-			rrs = append(rrs, r.Resolve(domain, question.Qtype)...)
+		start := time.Now()
+		ow := &observedWriter{ResponseWriter: w}
+		r.serveDNS(ow, msg, inUdp)
+		if ow.reply == nil {
+			return
 		}
-		m.Answer = append(m.Answer, rrs...)
-
-		// if in udp we check if we truncate to handle big answer and make dns client use tcp instead of udp to retrieve all
-		if inUdp {
-			m.Truncate(dns.DefaultMsgSize)
+		info := &QueryInfo{
+			Transport:    transport,
+			ClientIP:     addrIP(w.RemoteAddr()),
+			ClientPort:   addrPort(w.RemoteAddr()),
+			ServerIP:     addrIP(w.LocalAddr()),
+			ServerPort:   addrPort(w.LocalAddr()),
+			Time:         start,
+			Request:      msg,
+			Response:     ow.reply,
+			ResponseSize: ow.reply.Len(),
+			Duration:     time.Since(start),
+		}
+		if len(msg.Question) > 0 {
+			if entry := r.entryForName(msg.Question[0].Name); entry != nil {
+				info.EntryDomain = entry.Domain
+			}
 		}
+		r.observers.QueryServed(info)
+	})
+}
+
+func (r *Resolver) serveDNS(w dns.ResponseWriter, msg *dns.Msg, inUdp bool) {
+	clientIP := addrIP(w.RemoteAddr())
+	if reason := r.limits.admitQuery(clientIP); reason != "" {
+		r.refuse(w, msg, reason)
+		return
+	}
+	m := new(dns.Msg)
+	m.SetReply(msg)
+	m.Compress = true
+	rrs := make([]dns.RR, 0)
+	log.Debugf("receive request for with question: \n %s", msg.String())
+
+	udpSize, ok := r.setReplyEdns0(msg, m)
+	if !ok {
 		err := w.WriteMsg(m)
 		if err != nil {
 			log.Errorf("error writing dns response: %s", err.Error())
 		}
-	})
+		return
+	}
+
+	if len(msg.Question) == 1 && (msg.Question[0].Qtype == dns.TypeAXFR || msg.Question[0].Qtype == dns.TypeIXFR) {
+		r.serveTransfer(w, msg, inUdp)
+		return
+	}
+
+	if r.forwarder != nil && len(msg.Question) == 1 && !r.isLocalName(msg.Question[0].Name) {
+		m = r.forward(msg)
+		if inUdp {
+			m.Truncate(udpSize)
+		}
+		r.writeReply(w, msg, m, clientIP)
+		return
+	}
+
+	dnssecOK := msg.IsEdns0() != nil && msg.IsEdns0().Do()
+	view := r.viewForRequest(w, msg, m)
+	for _, question := range msg.Question {
+		zone := r.findZone(question.Name)
+		if zone == nil {
+			domain := strings.TrimSuffix(question.Name, ".")
+			rrs = append(rrs, r.ResolveInView(domain, question.Qtype, view)...)
+			continue
+		}
+		m.Authoritative = true
+		answer, ns, rcode := r.resolveInZone(zone, question, view)
+		if dnssecOK && zone.Signed() && len(answer) == 0 {
+			// names which does not exist are answered as NODATA to deny them with a single nsec
+			ns = append(ns, r.zoneNSEC(zone, question.Name, view))
+			rcode = dns.RcodeSuccess
+		}
+		rrs = append(rrs, answer...)
+		m.Ns = append(m.Ns, ns...)
+		if rcode != dns.RcodeSuccess {
+			m.Rcode = rcode
+		}
+	}
+	m.Answer = append(m.Answer, rrs...)
+	if dnssecOK {
+		r.signReply(m)
+	}
+
+	// if in udp we check if we truncate to handle big answer and make dns client use tcp instead of udp to retrieve all
+	// size is the one negotiated with edns0 or 512 bytes for client without edns0
+	if inUdp {
+		m.Truncate(udpSize)
+	}
+	r.writeReply(w, msg, m, clientIP)
+}
+
+// forward request to upstreams resolvers, answer with SERVFAIL if none of them could answer
+func (r *Resolver) forward(msg *dns.Msg) *dns.Msg {
+	r.observers.QueryForwarded()
+	resp, err := r.forwarder.Forward(msg)
+	if err != nil {
+		log.Errorf("error when forwarding dns request for %s: %s", msg.Question[0].Name, err.Error())
+		m := new(dns.Msg)
+		m.SetRcode(msg, dns.RcodeServerFailure)
+		return m
+	}
+	resp.Id = msg.Id
+	return resp
 }
 
 func (r *Resolver) RunWorkers(ctx context.Context) {
 	ticker := time.NewTicker(r.tickWorker)
 	go func() {
+		firstTick := true
 		for {
-			// do first tick
-			if !r.warmedUp {
+			// do first tick, entries are served from cache file meanwhile if there is one
+			if firstTick {
+				firstTick = false
+				if !r.isWarmedUp() && r.loadSnapshot() {
+					r.markWarmedUp()
+				}
 				r.dispatchWorker()
 				ticker.Reset(r.tickWorker)
 			}
@@ -159,22 +485,12 @@ func (r *Resolver) RunWorkers(ctx context.Context) {
 }
 
 func (r *Resolver) cleanNetdiscoResolved() {
-	keys := make([]string, 0)
-	now := time.Now()
-	r.netdiscoResolveCache.Range(func(key, value interface{}) bool {
-		if value.(*netdiscoResolved).ExpireWhen.After(now) {
-			return true
-		}
-		keys = append(keys, key.(string))
-		return true
-	})
-	for _, key := range keys {
-		r.netdiscoResolveCache.Delete(key)
-	}
+	r.lookupCache.PurgeExpired(time.Now())
 }
 
 func (r *Resolver) dispatchWorker() {
-	if !r.warmedUp {
+	warmedUp := r.isWarmedUp()
+	if !warmedUp {
 		log.WithField("nb_entries", len(r.entries)).Info("Warming up entries from netdisco ...")
 	}
 	wg := &sync.WaitGroup{}
@@ -186,22 +502,63 @@ func (r *Resolver) dispatchWorker() {
 	}
 
 	for _, entry := range r.entries {
+		if entry.IsAlias() {
+			continue
+		}
 		entryJobs <- entry
 	}
 	close(entryJobs)
 	wg.Wait()
-	if !r.warmedUp {
-		r.warmedUp = true
-		r.warmupChan <- true
+	if atomic.SwapInt32(&r.entriesLoaded, 0) == 1 {
+		r.saveSnapshot()
+	}
+	if atomic.SwapInt32(&r.devicesChanged, 0) == 1 {
+		r.bumpSerial()
+		if warmedUp {
+			log.WithField("serial", r.Serial()).Info("Devices changed, notifying secondaries.")
+			go r.notifySecondaries()
+		}
+	}
+	r.refreshedOnce.Do(func() {
+		close(r.refreshed)
+	})
+	if !warmedUp {
+		r.markWarmedUp()
 		log.WithField("nb_entries", len(r.entries)).Info("Finished warming up entries from netdisco.")
 	}
 }
 
+// Close flush and close outputs of dns observers, it must be called after dns servers have been stopped
+func (r *Resolver) Close() {
+	if r.dnstap != nil {
+		r.dnstap.Close()
+	}
+}
+
 func (r *Resolver) WaitWarmup() {
-	if r.warmedUp {
-		return
+	<-r.warmedUp
+}
+
+// WaitRefresh wait until entries have been refreshed from netdisco once,
+// unlike WaitWarmup it doesn't return when entries have been loaded from cache file
+func (r *Resolver) WaitRefresh() {
+	<-r.refreshed
+}
+
+// markWarmedUp release callers waiting for warmup, it can be called several times
+func (r *Resolver) markWarmedUp() {
+	r.warmupOnce.Do(func() {
+		close(r.warmedUp)
+	})
+}
+
+func (r *Resolver) isWarmedUp() bool {
+	select {
+	case <-r.warmedUp:
+		return true
+	default:
+		return false
 	}
-	<-r.warmupChan
 }
 
 func (r *Resolver) loadEntryWorker(entries <-chan *models.Entry, wg *sync.WaitGroup) {
@@ -210,12 +567,29 @@ func (r *Resolver) loadEntryWorker(entries <-chan *models.Entry, wg *sync.WaitGr
 	for entry := range entries {
 		entryLog := log.WithField("entry_domain", entry.Domain)
 		entryLog.Debug("Loading entry from netdisco ...")
+		start := time.Now()
 		devices, err := r.searchDevicesByEntry(entry)
+		nbDevices := len(devices)
+		if err == nil && entry.IPAliases.IsEnabled() {
+			devices = r.withIPAliases(entry, devices)
+		}
+		previousStatus := r.updateEntryStatus(entry.Domain, start, nbDevices, err)
 		if err != nil {
 			entryLog.Errorf("devices could not be retrieved: %s", err.Error())
 			continue
 		}
+		// only fresh devices are served, we check if they change
+		now := time.Now()
+		oldDevices, ok := r.entriesCacheResolve.Load(entry.Domain)
+		if !ok || devicesFingerprint(entry.FreshDevices(oldDevices.([]netdisco.Device), now)) !=
+			devicesFingerprint(entry.FreshDevices(devices, now)) {
+			atomic.StoreInt32(&r.devicesChanged, 1)
+		}
 		r.entriesCacheResolve.Store(entry.Domain, devices)
+		atomic.StoreInt32(&r.entriesLoaded, 1)
+		if previousStatus.Stale {
+			entryLog.Info("Stale devices replaced by devices from netdisco.")
+		}
 		entryLog.Debug("Finished loading entry from netdisco.")
 	}
 }
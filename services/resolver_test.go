@@ -0,0 +1,76 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/orange-cloudfoundry/go-netdisco"
+	"gopkg.in/yaml.v2"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+var testDevices = []netdisco.Device{
+	{Name: "sw1", DNS: "sw1.dc1.example.com", IP: "10.0.0.1", Vendor: "cisco", Model: "c9300", Os: "ios-xe", Location: "DC1"},
+	{Name: "sw2", DNS: "sw2.dc2.example.com", IP: "10.0.0.2", Vendor: "arista", Model: "7050", Os: "eos", Location: "DC2"},
+	{Name: "sw3", DNS: "sw3.dc1.example.com", IP: "2001:db8::3", Vendor: "juniper", Model: "qfx", Os: "junos", Location: "DC1"},
+}
+
+// testAddresses are addresses of testDevices served by fake netdisco device_ips api,
+// api answer with an error when testAddressesDown is set
+var (
+	testAddresses = map[string][]models.DeviceAddress{
+		"10.0.0.1": {
+			{Alias: "10.0.0.1", IP: "10.0.0.1", Port: "mgmt0"},
+			{Alias: "10.255.0.1", IP: "10.0.0.1", Port: "Loopback0"},
+		},
+	}
+	testAddressesDown int32
+)
+
+// newTestResolver give a resolver for config with entries loaded from a fake netdisco serving testDevices
+func newTestResolver(t *testing.T, config string) *Resolver {
+	t.Helper()
+	var cnf models.Config
+	err := yaml.Unmarshal([]byte(config), &cnf)
+	if err != nil {
+		t.Fatalf("invalid config: %s", err.Error())
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(req.URL.Path, "/device_ips") {
+			if atomic.LoadInt32(&testAddressesDown) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			ip := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/api/v1/object/device/"), "/device_ips")
+			json.NewEncoder(w).Encode(testAddresses[ip]) //nolint
+			return
+		}
+		devices := make([]netdisco.Device, 0)
+		for _, device := range testDevices {
+			if q := req.URL.Query(); q.Get("dns") != "" && q.Get("dns") != device.DNS || q.Get("ip") != "" && q.Get("ip") != device.IP {
+				continue
+			}
+			devices = append(devices, device)
+		}
+		json.NewEncoder(w).Encode(devices) //nolint
+	}))
+	t.Cleanup(srv.Close)
+	r := NewResolver(
+		cnf.Entries,
+		netdisco.NewClientWithApiKey(srv.URL, "key", true),
+		1,
+		time.Minute,
+		"",
+		cnf.Netdisco.LookupCache,
+		cnf.DNSServer,
+	)
+	r.dispatchWorker()
+	return r
+}
@@ -1,14 +1,17 @@
 package services
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/miekg/dns"
 	"github.com/orange-cloudfoundry/go-netdisco"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
 )
 
 func DevicesToIPs(targets []netdisco.Device) []net.IP {
@@ -22,15 +25,19 @@ func DevicesToIPs(targets []netdisco.Device) []net.IP {
 	return ips
 }
 
-func DevicesToRRS(domain string, targets []netdisco.Device, queryType ...uint16) []dns.RR {
+// DevicesToRRS create records for devices, entry give records configuration and can be nil to use defaults
+func DevicesToRRS(entry *models.Entry, domain string, targets []netdisco.Device, queryType ...uint16) []dns.RR {
 	rrs := make([]dns.RR, 0)
 	for _, qtype := range queryType {
-		rrs = append(rrs, MaterialsToRRSQueryType(domain, targets, qtype)...)
+		rrs = append(rrs, MaterialsToRRSQueryType(entry, domain, targets, qtype)...)
 	}
 	return rrs
 }
 
-func MaterialsToRRSQueryType(domain string, targets []netdisco.Device, queryType uint16) []dns.RR {
+func MaterialsToRRSQueryType(entry *models.Entry, domain string, targets []netdisco.Device, queryType uint16) []dns.RR {
+	if queryType == dns.TypeSRV {
+		return DevicesToSRV(entry, domain, targets, entry.SRVRecordsFor("", ""))
+	}
 	domain = dns.Fqdn(domain)
 	rrs := make([]dns.RR, 0)
 	queryTypeStr, ok := dns.TypeToString[queryType]
@@ -38,6 +45,13 @@ func MaterialsToRRSQueryType(domain string, targets []netdisco.Device, queryType
 		log.Errorf("query type is not supported")
 		return rrs
 	}
+	switch queryType {
+	case dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeHINFO, dns.TypeLOC:
+	default:
+		// no record of other types can be made from devices
+		return rrs
+	}
+	ttl := entry.RecordTTL()
 
 	for _, target := range targets {
 		if queryType == dns.TypeA && !DeviceIPIsV4(target) {
@@ -46,37 +60,253 @@ func MaterialsToRRSQueryType(domain string, targets []netdisco.Device, queryType
 		if queryType == dns.TypeAAAA && !DeviceIPIsV6(target) {
 			continue
 		}
-		if queryType == dns.TypeSRV && target.DNS == "" {
+		if queryType == dns.TypeTXT {
+			rrs = append(rrs, DeviceToTXT(entry, domain, target))
 			continue
 		}
-		var rr dns.RR
-		var err error
-		switch queryType {
-		case dns.TypeSRV:
-			rr, err = dns.NewRR(
-				fmt.Sprintf("%s 30 IN %s 1 1 22 %s", domain, queryTypeStr, DeviceStringRR(target, queryType)),
-			)
-		case dns.TypeTXT:
-			var b []byte
-			// could not happen error here
-			b, _ = json.Marshal(target) // nolint
-			rr, err = dns.NewRR(
-				fmt.Sprintf("%s IN %s %s", domain, queryTypeStr, base64.StdEncoding.EncodeToString(b)),
-			)
-		default:
-			rr, err = dns.NewRR(
-				fmt.Sprintf("%s 30 IN %s %s", domain, queryTypeStr, DeviceStringRR(target, queryType)),
-			)
+		if queryType == dns.TypeHINFO {
+			if rr := DeviceToHINFO(entry, domain, target); rr != nil {
+				rrs = append(rrs, rr)
+			}
+			continue
+		}
+		if queryType == dns.TypeLOC {
+			if rr := DeviceToLOC(entry, domain, target); rr != nil {
+				rrs = append(rrs, rr)
+			}
+			continue
 		}
+		rr, err := dns.NewRR(
+			fmt.Sprintf("%s %d IN %s %s", domain, ttl, queryTypeStr, DeviceStringRR(target, queryType)),
+		)
 		if err != nil {
 			log.WithField("target", target.IP).Errorf("could not register: %s", err.Error())
 			continue
 		}
 		rrs = append(rrs, rr)
 	}
+	// devices can give same records, e.g.: hinfo of same model or loc of same site
+	return dedupRRs(rrs)
+}
+
+// DeviceToTXT create a txt record with `key=value` strings from fields set in entry txt configuration
+// or with device in json if full json is asked, strings are split to respect 255 bytes limit of txt strings
+func DeviceToTXT(entry *models.Entry, domain string, device netdisco.Device) dns.RR {
+	txtConfig := entry.TXTConfig()
+	txts := make([]string, 0)
+	if txtConfig.FullJSON {
+		// could not happen error here
+		b, _ := json.Marshal(device) // nolint
+		txts = append(txts, txtStrings(string(b))...)
+	} else {
+		fields := models.DeviceFields(device)
+		for _, field := range txtConfig.Fields {
+			value := fields[field]
+			if value == "" {
+				continue
+			}
+			txts = append(txts, txtStrings(field+"="+value)...)
+		}
+	}
+	if len(txts) == 0 {
+		// txt record must have at least one string
+		txts = append(txts, "")
+	}
+	return &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(domain),
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    entry.RecordTTL(),
+		},
+		Txt: txts,
+	}
+}
+
+// DeviceToHINFO create a hinfo record with vendor and model as cpu and os with its version as os,
+// nil is returned when device has none of them
+func DeviceToHINFO(entry *models.Entry, domain string, device netdisco.Device) dns.RR {
+	cpu := strings.TrimSpace(device.Vendor + " " + device.Model)
+	os := strings.TrimSpace(device.Os + " " + device.OsVer)
+	if cpu == "" && os == "" {
+		return nil
+	}
+	return &dns.HINFO{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(domain),
+			Rrtype: dns.TypeHINFO,
+			Class:  dns.ClassINET,
+			Ttl:    entry.RecordTTL(),
+		},
+		Cpu: cpu,
+		Os:  os,
+	}
+}
+
+// DeviceToLOC create a loc record from device location with loc configuration of entry,
+// nil is returned when coordinates can't be found for location
+func DeviceToLOC(entry *models.Entry, domain string, device netdisco.Device) dns.RR {
+	loc := entry.LOCForDevice(device)
+	if loc == "" {
+		return nil
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN LOC %s", dns.Fqdn(domain), entry.RecordTTL(), loc))
+	if err != nil {
+		log.WithField("location", device.Location).Errorf("could not create loc record: %s", err.Error())
+		return nil
+	}
+	return rr
+}
+
+// maxTXTStringLen is the maximum length of a character-string in txt record
+const maxTXTStringLen = 255
+
+// txtEscaper escape characters which have a meaning in txt strings presentation format
+var txtEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// txtStrings split a value in character-strings of at most 255 bytes on the wire,
+// they are escaped after being split as txt record strings are in presentation format
+func txtStrings(value string) []string {
+	chunks := chunkString(value, maxTXTStringLen)
+	for i, chunk := range chunks {
+		chunks[i] = txtEscaper.Replace(chunk)
+	}
+	return chunks
+}
+
+// chunkString split string in chunks of at most size bytes without splitting utf-8 characters
+func chunkString(s string, size int) []string {
+	chunks := make([]string, 0, len(s)/size+1)
+	for len(s) > size {
+		end := size
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		if end == 0 {
+			// not valid utf-8, split on size
+			end = size
+		}
+		chunks = append(chunks, s[:end])
+		s = s[end:]
+	}
+	return append(chunks, s)
+}
+
+// DevicesToSRV create srv records for devices with a dns name, one record per device and srv configuration is created
+func DevicesToSRV(entry *models.Entry, domain string, targets []netdisco.Device, srvRecords []*models.SRVRecord) []dns.RR {
+	domain = dns.Fqdn(domain)
+	rrs := make([]dns.RR, 0)
+	ttl := entry.RecordTTL()
+	for _, srvRecord := range srvRecords {
+		for _, target := range targets {
+			if target.DNS == "" {
+				continue
+			}
+			rrs = append(rrs, &dns.SRV{
+				Hdr: dns.RR_Header{
+					Name:   domain,
+					Rrtype: dns.TypeSRV,
+					Class:  dns.ClassINET,
+					Ttl:    ttl,
+				},
+				Priority: srvRecord.Priority,
+				Weight:   srvRecord.Weight,
+				Port:     srvRecord.Port,
+				Target:   DeviceStringRR(target, dns.TypeSRV),
+			})
+		}
+	}
+	// devices served with their ip aliases have the same target several times
+	return dedupRRs(rrs)
+}
+
+// DevicesToPTR create ptr records for devices, entry give ttl of records and can be nil to use default ttl
+func DevicesToPTR(entry *models.Entry, domain string, targets []netdisco.Device) []dns.RR {
+	domain = dns.Fqdn(domain)
+	rrs := make([]dns.RR, 0)
+	alreadySet := make(map[string]bool)
+	for _, target := range targets {
+		host := DevicePTRTarget(target)
+		if host == "" || alreadySet[host] {
+			continue
+		}
+		alreadySet[host] = true
+		rrs = append(rrs, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   domain,
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    entry.RecordTTL(),
+			},
+			Ptr: host,
+		})
+	}
 	return rrs
 }
 
+// DevicePTRTarget give the name to use in a ptr record for a device, dns name is preferred over device name
+// and empty string is returned if none of them can be used as a domain name
+func DevicePTRTarget(device netdisco.Device) string {
+	for _, name := range []string{device.DNS, device.Name} {
+		if name == "" {
+			continue
+		}
+		if _, ok := dns.IsDomainName(name); ok {
+			return dns.Fqdn(strings.ToLower(name))
+		}
+	}
+	return ""
+}
+
+// splitSRVName split a name in the form _<service>._<proto>.<domain>,
+// service and proto are empty if name is not in this form
+func splitSRVName(domain string) (service, proto, baseDomain string) {
+	labels := strings.SplitN(domain, ".", 3)
+	if len(labels) != 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return "", "", domain
+	}
+	return strings.TrimPrefix(labels[0], "_"), strings.TrimPrefix(labels[1], "_"), labels[2]
+}
+
+func IsReverseName(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return strings.HasSuffix(domain, ".in-addr.arpa") || strings.HasSuffix(domain, ".ip6.arpa")
+}
+
+// ReverseNameToIP convert a in-addr.arpa or ip6.arpa name to its ip,
+// nil is returned if name is not a complete reverse name
+func ReverseNameToIP(domain string) net.IP {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if strings.HasSuffix(domain, ".in-addr.arpa") {
+		labels := strings.Split(strings.TrimSuffix(domain, ".in-addr.arpa"), ".")
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		return net.ParseIP(strings.Join(labels, ".")).To4()
+	}
+	if strings.HasSuffix(domain, ".ip6.arpa") {
+		nibbles := strings.Split(strings.TrimSuffix(domain, ".ip6.arpa"), ".")
+		if len(nibbles) != net.IPv6len*2 {
+			return nil
+		}
+		buf := &strings.Builder{}
+		for i := len(nibbles) - 1; i >= 0; i-- {
+			if len(nibbles[i]) != 1 {
+				return nil
+			}
+			buf.WriteString(nibbles[i])
+			if i%4 == 0 && i != 0 {
+				buf.WriteString(":")
+			}
+		}
+		return net.ParseIP(buf.String())
+	}
+	return nil
+}
+
 func DeviceIP(device netdisco.Device) net.IP {
 	ip := net.ParseIP(device.IP)
 	return ip
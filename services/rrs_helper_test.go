@@ -0,0 +1,200 @@
+package services
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+	"github.com/orange-cloudfoundry/go-netdisco"
+	pmodel "github.com/prometheus/common/model"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+func TestReverseNameToIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+	}{
+		{"1.0.0.10.in-addr.arpa.", "10.0.0.1"},
+		{"1.0.0.10.IN-ADDR.ARPA", "10.0.0.1"},
+		{"3.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "2001:db8::3"},
+		{"0.0.10.in-addr.arpa.", ""},
+		{"256.0.0.10.in-addr.arpa.", ""},
+		{"3.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.2.ip6.arpa.", ""},
+		{"30.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", ""},
+		{"x.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", ""},
+		{"sw1.example.", ""},
+	}
+	for _, test := range tests {
+		ip := ReverseNameToIP(test.name)
+		if test.ip == "" {
+			if ip != nil {
+				t.Errorf("ReverseNameToIP(%s) = %s, want nil", test.name, ip)
+			}
+			continue
+		}
+		if !ip.Equal(net.ParseIP(test.ip)) {
+			t.Errorf("ReverseNameToIP(%s) = %s, want %s", test.name, ip, test.ip)
+		}
+	}
+}
+
+func TestDevicesToPTR(t *testing.T) {
+	devices := []netdisco.Device{
+		{DNS: "sw1.example.com", Name: "sw1", IP: "10.0.0.1"},
+		{DNS: "SW1.example.com", Name: "sw1-alias", IP: "10.0.0.1"},
+		{Name: "sw1-mgmt", IP: "10.0.0.1"},
+	}
+	tests := []struct {
+		name  string
+		entry *models.Entry
+		ttl   uint32
+	}{
+		{"entry ttl", &models.Entry{TTL: pmodel.Duration(5 * time.Minute)}, 300},
+		{"entry without ttl", &models.Entry{}, 30},
+		{"no entry", nil, 30},
+	}
+	for _, test := range tests {
+		rrs := DevicesToPTR(test.entry, "1.0.0.10.in-addr.arpa", devices)
+		if len(rrs) != 2 {
+			t.Errorf("%s: expected one ptr per target, got %v", test.name, rrs)
+		}
+		for _, rr := range rrs {
+			if rr.Header().Name != "1.0.0.10.in-addr.arpa." || rr.Header().Ttl != test.ttl {
+				t.Errorf("%s: unexpected ptr record %s", test.name, rr)
+			}
+		}
+	}
+}
+
+func TestDevicePTRTarget(t *testing.T) {
+	tests := []struct {
+		device netdisco.Device
+		target string
+	}{
+		{netdisco.Device{DNS: "SW1.example.com", Name: "sw1"}, "sw1.example.com."},
+		{netdisco.Device{Name: "sw1"}, "sw1."},
+		{netdisco.Device{DNS: "bad..name", Name: "sw1"}, "sw1."},
+		{netdisco.Device{Name: "bad..name"}, ""},
+		{netdisco.Device{}, ""},
+	}
+	for _, test := range tests {
+		if got := DevicePTRTarget(test.device); got != test.target {
+			t.Errorf("DevicePTRTarget(dns=%q, name=%q) = %q, want %q", test.device.DNS, test.device.Name, got, test.target)
+		}
+	}
+}
+
+func TestChunkString(t *testing.T) {
+	tests := []struct {
+		s      string
+		size   int
+		chunks []string
+	}{
+		{"", 3, []string{""}},
+		{"ab", 3, []string{"ab"}},
+		{"abc", 3, []string{"abc"}},
+		{"abcd", 3, []string{"abc", "d"}},
+		{"abcdefg", 3, []string{"abc", "def", "g"}},
+		// utf-8 characters are not split
+		{"abé", 3, []string{"ab", "é"}},
+		{"aéé", 3, []string{"aé", "é"}},
+		{"\xff\xff\xff\xff", 3, []string{"\xff\xff\xff", "\xff"}},
+	}
+	for _, test := range tests {
+		if got := chunkString(test.s, test.size); !reflect.DeepEqual(got, test.chunks) {
+			t.Errorf("chunkString(%q, %d) = %q, want %q", test.s, test.size, got, test.chunks)
+		}
+	}
+}
+
+// txtWireStrings give strings of txt record as sent on the wire
+func txtWireStrings(t *testing.T, txt *dns.TXT) []string {
+	t.Helper()
+	buf := make([]byte, dns.Len(txt))
+	off, err := dns.PackRR(txt, buf, 0, nil, false)
+	if err != nil {
+		t.Fatalf("record can't be packed: %s", err.Error())
+	}
+	rdata := buf[off-int(txt.Hdr.Rdlength) : off]
+	strs := make([]string, 0)
+	for len(rdata) > 0 {
+		l := int(rdata[0])
+		strs = append(strs, string(rdata[1:1+l]))
+		rdata = rdata[1+l:]
+	}
+	return strs
+}
+
+func TestDeviceToTXT(t *testing.T) {
+	device := netdisco.Device{
+		Name:     "sw1",
+		Vendor:   "cisco",
+		Model:    `c9300 "48p"`,
+		Os:       `ios\xe`,
+		Location: strings.Repeat("x", 245) + "é salle",
+	}
+	deviceJSON, _ := json.Marshal(device) // nolint
+	tests := []struct {
+		name  string
+		txt   *models.TXTConfig
+		check func(strs []string) bool
+	}{
+		{
+			name: "fields",
+			txt:  &models.TXTConfig{Fields: []string{"name", "serial", "vendor"}},
+			check: func(strs []string) bool {
+				return reflect.DeepEqual(strs, []string{"name=sw1", "vendor=cisco"})
+			},
+		},
+		{
+			name: "backslash and quotes are sent as is",
+			txt:  &models.TXTConfig{Fields: []string{"model", "os"}},
+			check: func(strs []string) bool {
+				return reflect.DeepEqual(strs, []string{`model=c9300 "48p"`, `os=ios\xe`})
+			},
+		},
+		{
+			name: "long field is split in strings of 255 bytes without splitting characters",
+			txt:  &models.TXTConfig{Fields: []string{"location"}},
+			check: func(strs []string) bool {
+				return len(strs) == 2 && utf8.ValidString(strs[0]) && utf8.ValidString(strs[1]) &&
+					strs[0]+strs[1] == "location="+device.Location
+			},
+		},
+		{
+			name: "no field set give one empty string",
+			txt:  &models.TXTConfig{Fields: []string{"serial"}},
+			check: func(strs []string) bool {
+				return reflect.DeepEqual(strs, []string{""})
+			},
+		},
+		{
+			name: "full json",
+			txt:  &models.TXTConfig{FullJSON: true},
+			check: func(strs []string) bool {
+				return len(strs) > 1 && strings.Join(strs, "") == string(deviceJSON)
+			},
+		},
+	}
+	for _, test := range tests {
+		entry := &models.Entry{Domain: "all.example", TXT: test.txt}
+		rr := DeviceToTXT(entry, "all.example", device)
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			t.Fatalf("%s: expected txt record, got %s", test.name, rr)
+		}
+		if txt.Hdr.Name != "all.example." {
+			t.Errorf("%s: record name is %s", test.name, txt.Hdr.Name)
+		}
+		if strs := txtWireStrings(t, txt); !test.check(strs) {
+			t.Errorf("%s: unexpected txt strings %q", test.name, strs)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/orange-cloudfoundry/go-netdisco"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// entrySnapshot is devices of an entry saved on disk with time they were retrieved from netdisco
+type entrySnapshot struct {
+	Devices   []netdisco.Device `json:"devices"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// cacheSnapshot is devices of all entries saved on disk after each refresh,
+// it is loaded at boot to answer before netdisco has been reached
+type cacheSnapshot struct {
+	Entries map[string]*entrySnapshot `json:"entries"`
+}
+
+// loadSnapshot load devices of entries from cache file, they are served as stale until entries are refreshed from netdisco.
+// False is returned when there is no snapshot to load
+func (r *Resolver) loadSnapshot() bool {
+	if r.cacheFile == "" {
+		return false
+	}
+	b, err := os.ReadFile(r.cacheFile)
+	if os.IsNotExist(err) {
+		return false
+	}
+	if err != nil {
+		log.Warnf("cache file could not be read: %s", err.Error())
+		return false
+	}
+	var snapshot cacheSnapshot
+	err = json.Unmarshal(b, &snapshot)
+	if err != nil {
+		log.Warnf("cache file could not be loaded: %s", err.Error())
+		return false
+	}
+	nbEntries := 0
+	for _, e := range r.entries {
+		entrySnap, ok := snapshot.Entries[e.Domain]
+		if e.IsAlias() || !ok {
+			continue
+		}
+		r.entriesCacheResolve.Store(e.Domain, entrySnap.Devices)
+		updatedAt := entrySnap.UpdatedAt
+		r.entriesStatus.Store(e.Domain, models.EntryStatus{
+			Domain:      e.Domain,
+			LastSuccess: &updatedAt,
+			DeviceCount: len(entrySnap.Devices),
+			Stale:       true,
+		})
+		nbEntries++
+	}
+	if nbEntries == 0 {
+		return false
+	}
+	log.WithField("nb_entries", nbEntries).WithField("cache_file", r.cacheFile).
+		Info("Entries loaded from cache file, they are served as stale until netdisco answers.")
+	return true
+}
+
+// saveSnapshot write devices of all loaded entries in cache file,
+// file is written then renamed to never leave a partial snapshot
+func (r *Resolver) saveSnapshot() {
+	if r.cacheFile == "" {
+		return
+	}
+	snapshot := cacheSnapshot{
+		Entries: make(map[string]*entrySnapshot),
+	}
+	for _, e := range r.entries {
+		rawMaterials, ok := r.entriesCacheResolve.Load(e.Domain)
+		if e.IsAlias() || !ok {
+			continue
+		}
+		entrySnap := &entrySnapshot{
+			Devices: rawMaterials.([]netdisco.Device),
+		}
+		if lastSuccess := r.entryStatus(e.Domain).LastSuccess; lastSuccess != nil {
+			entrySnap.UpdatedAt = *lastSuccess
+		}
+		snapshot.Entries[e.Domain] = entrySnap
+	}
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Errorf("error when encoding cache file: %s", err.Error())
+		return
+	}
+	tmpFile := r.cacheFile + ".tmp"
+	err = os.WriteFile(tmpFile, b, 0600)
+	if err == nil {
+		err = os.Rename(tmpFile, r.cacheFile)
+	}
+	if err != nil {
+		log.Errorf("error when writing cache file: %s", err.Error())
+	}
+}
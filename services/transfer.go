@@ -0,0 +1,259 @@
+package services
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/orange-cloudfoundry/go-netdisco"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// maxTransferMsgSize is the maximum size of each message of a zone transfer,
+// room is left under the 64KB limit of dns messages over tcp for a tsig record
+const maxTransferMsgSize = dns.MaxMsgSize - 1024
+
+// servedTypes are record types which can be created from devices
+var servedTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeSRV, dns.TypeTXT, dns.TypeHINFO, dns.TypeLOC}
+
+// ZoneRecords give all records served in a zone except SOA,
+// this include NS, entries domains records, per-device records and ptr for devices ips in reverse zones
+func (r *Resolver) ZoneRecords(zone *models.DNSZone) []dns.RR {
+	rrs := r.zoneNS(zone)
+	for _, e := range r.entries {
+		if !zone.Contains(dns.Fqdn(e.Domain)) {
+			continue
+		}
+		if e.IsAlias() {
+			rrs = append(rrs, r.aliasCNAME(e, e.Domain, nil)...)
+			continue
+		}
+		devices := r.DevicesFromEntry(e)
+		rrs = append(rrs, r.entryNameRecords(e, e.Domain, devices)...)
+		devicesByLabel := make(map[string][]netdisco.Device)
+		labels := make([]string, 0)
+		for _, device := range devices {
+			for _, label := range e.LabelsForDevice(device) {
+				if _, ok := devicesByLabel[label]; !ok {
+					labels = append(labels, label)
+				}
+				devicesByLabel[label] = append(devicesByLabel[label], device)
+			}
+		}
+		for _, label := range labels {
+			rrs = append(rrs, r.entryNameRecords(e, label+"."+e.Domain, devicesByLabel[label])...)
+		}
+	}
+	if IsReverseName(zone.Name) {
+		rrs = append(rrs, r.zonePTRs(zone)...)
+	}
+	return dedupRRs(rrs)
+}
+
+// entryNameRecords give all records served for a name from entry, including srv records of services under this name
+func (r *Resolver) entryNameRecords(e *models.Entry, domain string, devices []netdisco.Device) []dns.RR {
+	rrs := DevicesToRRS(e, domain, devices, servedTypes...)
+	for _, srvRecord := range e.SRV {
+		if srvRecord.Service == "" {
+			continue
+		}
+		rrs = append(rrs, DevicesToSRV(e, srvRecord.Prefix()+domain, devices, []*models.SRVRecord{srvRecord})...)
+	}
+	return rrs
+}
+
+func (r *Resolver) zonePTRs(zone *models.DNSZone) []dns.RR {
+	devicesByName := make(map[string][]netdisco.Device)
+	// ptr records of a name have ttl of first entry giving this ip, as when answering queries
+	entryByName := make(map[string]*models.Entry)
+	names := make([]string, 0)
+	for _, e := range r.entries {
+		if e.IsAlias() {
+			continue
+		}
+		for _, device := range r.DevicesFromEntry(e) {
+			name, err := dns.ReverseAddr(device.IP)
+			if err != nil || !zone.Contains(name) {
+				continue
+			}
+			if _, ok := devicesByName[name]; !ok {
+				names = append(names, name)
+				entryByName[name] = e
+			}
+			devicesByName[name] = append(devicesByName[name], device)
+		}
+	}
+	rrs := make([]dns.RR, 0)
+	for _, name := range names {
+		rrs = append(rrs, DevicesToPTR(entryByName[name], name, devicesByName[name])...)
+	}
+	return rrs
+}
+
+func dedupRRs(rrs []dns.RR) []dns.RR {
+	alreadySet := make(map[string]bool)
+	finalRRs := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		key := strings.ToLower(rr.String())
+		if alreadySet[key] {
+			continue
+		}
+		alreadySet[key] = true
+		finalRRs = append(finalRRs, rr)
+	}
+	return finalRRs
+}
+
+// serveTransfer answer to AXFR and IXFR requests,
+// IXFR is answered with only the SOA when client is up to date or with the full zone otherwise
+// as we don't keep history of changes between serials
+func (r *Resolver) serveTransfer(w dns.ResponseWriter, req *dns.Msg, inUdp bool) {
+	question := req.Question[0]
+	entry := log.WithField("zone", question.Name).WithField("client", w.RemoteAddr().String())
+	m := new(dns.Msg)
+	zone := r.findZone(question.Name)
+	switch {
+	case zone == nil || zone.Name != strings.ToLower(dns.Fqdn(question.Name)):
+		m.SetRcode(req, dns.RcodeNotAuth)
+	case !r.transferAllowed.Contains(addrIP(w.RemoteAddr())):
+		entry.Warn("zone transfer refused")
+		m.SetRcode(req, dns.RcodeRefused)
+	case zone.Signed():
+		// records are signed on the fly with black lies nsec, there is no signed zone a secondary could serve
+		entry.Warn("zone transfer refused, signed zones can not be transferred")
+		m.SetRcode(req, dns.RcodeRefused)
+	case question.Qtype == dns.TypeIXFR && r.ixfrUpToDate(req):
+		m.SetReply(req)
+		m.Authoritative = true
+		m.Answer = []dns.RR{r.zoneSOA(zone)}
+	case inUdp && question.Qtype == dns.TypeIXFR:
+		// zone can't be sent in udp, give soa to let client retry in tcp
+		m.SetReply(req)
+		m.Authoritative = true
+		m.Answer = []dns.RR{r.zoneSOA(zone)}
+	case inUdp:
+		m.SetRcode(req, dns.RcodeRefused)
+	default:
+		entry.Info("sending zone transfer")
+		r.transferZone(w, req, zone)
+		return
+	}
+	err := w.WriteMsg(m)
+	if err != nil {
+		log.Errorf("error writing dns response: %s", err.Error())
+	}
+}
+
+func (r *Resolver) transferZone(w dns.ResponseWriter, req *dns.Msg, zone *models.DNSZone) {
+	soa := r.zoneSOA(zone)
+	rrs := append([]dns.RR{soa}, r.ZoneRecords(zone)...)
+	rrs = append(rrs, soa)
+
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- tr.Out(w, req, ch)
+	}()
+	var err error
+	outDone := false
+	for _, envelope := range transferEnvelopes(req, rrs) {
+		// transfer stops on first write error, e.g. when client close connection,
+		// nobody read remaining envelopes in this case
+		select {
+		case ch <- envelope:
+			continue
+		case err = <-errChan:
+			outDone = true
+		}
+		break
+	}
+	close(ch)
+	if !outDone {
+		err = <-errChan
+	}
+	if err != nil {
+		log.Errorf("error when sending zone transfer for %s: %s", zone.Name, err.Error())
+	}
+}
+
+// transferEnvelopes split records of a zone transfer in envelopes
+// which are sent in messages of at most maxTransferMsgSize bytes
+func transferEnvelopes(req *dns.Msg, rrs []dns.RR) []*dns.Envelope {
+	reply := new(dns.Msg)
+	reply.SetReply(req)
+	// transfer messages are not compressed, size of records can be summed
+	baseLen := reply.Len()
+	envelopes := make([]*dns.Envelope, 0)
+	current := &dns.Envelope{}
+	currentLen := baseLen
+	for _, rr := range rrs {
+		rrLen := dns.Len(rr)
+		if len(current.RR) > 0 && currentLen+rrLen > maxTransferMsgSize {
+			envelopes = append(envelopes, current)
+			current = &dns.Envelope{}
+			currentLen = baseLen
+		}
+		current.RR = append(current.RR, rr)
+		currentLen += rrLen
+	}
+	if len(current.RR) > 0 {
+		envelopes = append(envelopes, current)
+	}
+	return envelopes
+}
+
+// ixfrUpToDate check if serial sent by client in IXFR request is the same or newer than ours
+func (r *Resolver) ixfrUpToDate(req *dns.Msg) bool {
+	for _, rr := range req.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+		return !serialLess(soa.Serial, r.Serial())
+	}
+	return false
+}
+
+// serialLess compare serials with serial number arithmetic as defined in rfc1982
+func serialLess(s1, s2 uint32) bool {
+	return s1 != s2 && int32(s2-s1) > 0
+}
+
+func addrPort(addr net.Addr) int {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.Port
+	case *net.TCPAddr:
+		return a.Port
+	}
+	if addr == nil {
+		return 0
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0
+	}
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// transferWriter record messages of a zone transfer, writes fail after failAfter messages when set
+type transferWriter struct {
+	dns.ResponseWriter
+	msgs      []*dns.Msg
+	failAfter int
+}
+
+func (w *transferWriter) WriteMsg(m *dns.Msg) error {
+	if w.failAfter > 0 && len(w.msgs) >= w.failAfter {
+		return errors.New("connection reset by peer")
+	}
+	w.msgs = append(w.msgs, m)
+	return nil
+}
+
+func (w *transferWriter) TsigStatus() error { return nil }
+
+func (w *transferWriter) TsigTimersOnly(bool) {}
+
+func (w *transferWriter) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+}
+
+// newLargeZoneResolver give a resolver serving a zone too large to be transferred in one message
+func newLargeZoneResolver(t *testing.T) *Resolver {
+	config := &strings.Builder{}
+	config.WriteString(`
+netdisco: {endpoint: http://netdisco}
+dns_server:
+  zones:
+  - name: example
+    ns: [ns1.example]
+entries:
+`)
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(config, "- {domain: e%d.example, txt: {full_json: true}, targets: [{q: '%%'}]}\n", i)
+	}
+	return newTestResolver(t, config.String())
+}
+
+func TestSerialLess(t *testing.T) {
+	tests := []struct {
+		s1, s2 uint32
+		less   bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{5, 5, false},
+		{0, 1<<31 - 1, true},
+		// at a distance of 2^31 comparison is undefined, it must not be less both ways
+		{0, 1 << 31, false},
+		{1 << 31, 0, false},
+		// serial wraps around
+		{4294967295, 0, true},
+		{4294967290, 10, true},
+		{10, 4294967290, false},
+	}
+	for _, test := range tests {
+		if got := serialLess(test.s1, test.s2); got != test.less {
+			t.Errorf("serialLess(%d, %d) = %t, want %t", test.s1, test.s2, got, test.less)
+		}
+	}
+}
+
+func TestIxfrUpToDate(t *testing.T) {
+	r := &Resolver{serial: 1000}
+	tests := []struct {
+		name     string
+		ns       []dns.RR
+		upToDate bool
+	}{
+		{"no soa", nil, false},
+		{"older serial", []dns.RR{&dns.SOA{Serial: 999}}, false},
+		{"same serial", []dns.RR{&dns.SOA{Serial: 1000}}, true},
+		{"newer serial", []dns.RR{&dns.SOA{Serial: 1001}}, true},
+		{"soa after other record", []dns.RR{&dns.NS{Ns: "ns1.example."}, &dns.SOA{Serial: 1000}}, true},
+	}
+	for _, test := range tests {
+		req := new(dns.Msg)
+		req.SetIxfr("example.", 0, "", "")
+		req.Ns = test.ns
+		if got := r.ixfrUpToDate(req); got != test.upToDate {
+			t.Errorf("%s: ixfrUpToDate = %t, want %t", test.name, got, test.upToDate)
+		}
+	}
+}
+
+func TestTransferZone(t *testing.T) {
+	r := newLargeZoneResolver(t)
+	zone := r.Zone("example")
+	req := new(dns.Msg)
+	req.SetAxfr("example.")
+
+	w := &transferWriter{}
+	r.transferZone(w, req, zone)
+	if len(w.msgs) < 2 {
+		t.Fatalf("zone must be sent in several messages, got %d", len(w.msgs))
+	}
+	rrs := make([]dns.RR, 0)
+	for _, m := range w.msgs {
+		if m.Len() > dns.MaxMsgSize {
+			t.Errorf("message of %d bytes is over max dns message size", m.Len())
+		}
+		if _, err := m.Pack(); err != nil {
+			t.Errorf("message can't be packed: %s", err.Error())
+		}
+		rrs = append(rrs, m.Answer...)
+	}
+	if len(rrs) != len(r.ZoneRecords(zone))+2 || rrs[0].Header().Rrtype != dns.TypeSOA || rrs[len(rrs)-1].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("transfer must contain all records of zone between soa, got %d records", len(rrs))
+	}
+
+	// client leaving in the middle of transfer must not block sender
+	done := make(chan struct{})
+	go func() {
+		r.transferZone(&transferWriter{failAfter: 1}, req, zone)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("zone transfer blocked after write error")
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// viewForRequest give the view matching client of request, nil is returned if no view match.
+// When client sent an edns client subnet option it is echoed in reply as required by RFC 7871,
+// scope is set to source prefix when the option was used to choose view.
+func (r *Resolver) viewForRequest(w dns.ResponseWriter, req *dns.Msg, reply *dns.Msg) *models.View {
+	if len(r.views) == 0 {
+		return nil
+	}
+	ecs := requestECS(req)
+	var ecsIP net.IP
+	if ecs != nil {
+		ecsIP = ecs.Address
+	}
+	view := r.views.ForClient(addrIP(w.RemoteAddr()), ecsIP)
+	replyOpt := reply.IsEdns0()
+	if ecs == nil || replyOpt == nil {
+		return view
+	}
+	scope := uint8(0)
+	if view != nil && view.UseECS {
+		scope = ecs.SourceNetmask
+	}
+	replyOpt.Option = append(replyOpt.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        ecs.Family,
+		SourceNetmask: ecs.SourceNetmask,
+		SourceScope:   scope,
+		Address:       ecs.Address,
+	})
+	return view
+}
+
+// requestECS give the edns client subnet option of request, nil is returned if not set
+func requestECS(req *dns.Msg) *dns.EDNS0_SUBNET {
+	opt := req.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, option := range opt.Option {
+		if ecs, ok := option.(*dns.EDNS0_SUBNET); ok {
+			return ecs
+		}
+	}
+	return nil
+}
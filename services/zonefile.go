@@ -0,0 +1,68 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// Zone give the authoritative zone with this exact name, nil is returned if zone is not served
+func (r *Resolver) Zone(name string) *models.DNSZone {
+	name = dns.Fqdn(strings.ToLower(name))
+	for _, zone := range r.zones {
+		if zone.Name == name {
+			return zone
+		}
+	}
+	return nil
+}
+
+// WriteZoneFile write soa and all records served in zone in rfc1035 master file format.
+// Records are sorted in canonical order to give the same file between exports when devices don't change,
+// dnssec records are not written as signatures change on each export
+func (r *Resolver) WriteZoneFile(w io.Writer, zone *models.DNSZone) error {
+	rrs := r.ZoneRecords(zone)
+	sortRRs(rrs)
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "; zone %s generated by netdisco-bridges\n", zone.Name)
+	fmt.Fprintf(buf, "$ORIGIN %s\n", zone.Name)
+	fmt.Fprintln(buf, r.zoneSOA(zone).String())
+	for _, rr := range rrs {
+		fmt.Fprintln(buf, rr.String())
+	}
+	return buf.Flush()
+}
+
+// sortRRs sort records by owner name in canonical order (rfc4034 section 6.1), then by type and data
+func sortRRs(rrs []dns.RR) {
+	names := make(map[dns.RR]string, len(rrs))
+	for _, rr := range rrs {
+		names[rr] = canonicalNameKey(rr.Header().Name)
+	}
+	sort.SliceStable(rrs, func(i, j int) bool {
+		if names[rrs[i]] != names[rrs[j]] {
+			return names[rrs[i]] < names[rrs[j]]
+		}
+		if rrs[i].Header().Rrtype != rrs[j].Header().Rrtype {
+			return rrs[i].Header().Rrtype < rrs[j].Header().Rrtype
+		}
+		return rrs[i].String() < rrs[j].String()
+	})
+}
+
+// canonicalNameKey give a key of name which sort names in canonical order,
+// labels are reversed so names are sorted from the most significant label
+func canonicalNameKey(name string) string {
+	labels := dns.SplitDomainName(strings.ToLower(name))
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	// label separator sort before any character allowed in labels to keep parent before children
+	return strings.Join(labels, "\x00")
+}
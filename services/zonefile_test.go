@@ -0,0 +1,69 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestWriteZoneFile(t *testing.T) {
+	r := newTestResolver(t, `
+netdisco: {endpoint: http://netdisco}
+dns_server:
+  zones:
+  - name: example
+    ns: [ns1.example]
+entries:
+- domain: all.example
+  srv: [{service: netconf, proto: tcp, port: 830}]
+  targets: [{q: '%'}]
+- domain: friendly.example
+  alias: {entry: all.example}
+`)
+	zone := r.Zone("example")
+	buf := &strings.Builder{}
+	err := r.WriteZoneFile(buf, zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := make([]dns.RR, 0)
+	zp := dns.NewZoneParser(strings.NewReader(buf.String()), "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		parsed = append(parsed, rr)
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatalf("zone file can't be parsed: %s", err.Error())
+	}
+	if len(parsed) == 0 || parsed[0].Header().Rrtype != dns.TypeSOA || parsed[0].(*dns.SOA).Serial != r.Serial() {
+		t.Fatalf("zone file must start with soa of zone")
+	}
+
+	expected := make(map[string]bool)
+	for _, rr := range r.ZoneRecords(zone) {
+		expected[rr.String()] = true
+	}
+	for _, rr := range parsed[1:] {
+		if !expected[rr.String()] {
+			t.Errorf("unexpected record in zone file: %s", rr)
+		}
+		delete(expected, rr.String())
+	}
+	for rr := range expected {
+		t.Errorf("record missing in zone file: %s", rr)
+	}
+
+	// records are sorted, export of same devices give same file
+	again := &strings.Builder{}
+	err = r.WriteZoneFile(again, zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != buf.String() {
+		t.Errorf("zone file change between exports of same devices")
+	}
+	if !strings.Contains(buf.String(), "friendly.example.\t30\tIN\tCNAME\tall.example.") {
+		t.Errorf("alias entry missing in zone file")
+	}
+}
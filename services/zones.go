@@ -0,0 +1,134 @@
+package services
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orange-cloudfoundry/netdisco-bridges/models"
+)
+
+// findZone give the most specific authoritative zone containing domain, nil is returned if none match
+func (r *Resolver) findZone(domain string) *models.DNSZone {
+	domain = dns.Fqdn(domain)
+	var found *models.DNSZone
+	for _, zone := range r.zones {
+		if !zone.Contains(domain) {
+			continue
+		}
+		if found == nil || dns.CountLabel(zone.Name) > dns.CountLabel(found.Name) {
+			found = zone
+		}
+	}
+	return found
+}
+
+func (r *Resolver) Serial() uint32 {
+	return atomic.LoadUint32(&r.serial)
+}
+
+// bumpSerial increment zones serial, unix timestamp is used when greater to keep serial meaningful
+func (r *Resolver) bumpSerial() {
+	serial := r.Serial() + 1
+	now := uint32(time.Now().Unix())
+	if serialLess(serial, now) {
+		serial = now
+	}
+	atomic.StoreUint32(&r.serial, serial)
+}
+
+func (r *Resolver) zoneSOA(zone *models.DNSZone) *dns.SOA {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone.Name,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    models.DurationToTTL(zone.TTL),
+		},
+		Ns:      zone.NS[0],
+		Mbox:    zone.Mbox,
+		Serial:  r.Serial(),
+		Refresh: models.DurationToTTL(zone.Refresh),
+		Retry:   models.DurationToTTL(zone.Retry),
+		Expire:  models.DurationToTTL(zone.Expire),
+		Minttl:  models.DurationToTTL(zone.MinTTL),
+	}
+}
+
+// zoneNegativeSOA give soa to set in authority section for negative answers,
+// ttl is the minimum of soa ttl and soa minimum field as defined in rfc2308
+func (r *Resolver) zoneNegativeSOA(zone *models.DNSZone) *dns.SOA {
+	soa := r.zoneSOA(zone)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return soa
+}
+
+func (r *Resolver) zoneNS(zone *models.DNSZone) []dns.RR {
+	rrs := make([]dns.RR, len(zone.NS))
+	for i, ns := range zone.NS {
+		rrs[i] = &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   zone.Name,
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    models.DurationToTTL(zone.TTL),
+			},
+			Ns: ns,
+		}
+	}
+	return rrs
+}
+
+// resolveInZone answer a question as an authoritative server for the zone,
+// unknown names give NXDOMAIN and known names without record of the asked type give NODATA,
+// soa is set in authority section in both case for negative caching
+func (r *Resolver) resolveInZone(zone *models.DNSZone, question dns.Question, view *models.View) (answer []dns.RR, ns []dns.RR, rcode int) {
+	qname := dns.Fqdn(strings.ToLower(question.Name))
+	domain := strings.TrimSuffix(qname, ".")
+	isApex := qname == zone.Name
+	answer = make([]dns.RR, 0)
+	if isApex && question.Qtype == dns.TypeSOA {
+		answer = append(answer, r.zoneSOA(zone))
+	}
+	if isApex && question.Qtype == dns.TypeNS {
+		answer = append(answer, r.zoneNS(zone)...)
+	}
+	if isApex && question.Qtype == dns.TypeDNSKEY && zone.Signed() {
+		answer = append(answer, r.zoneDNSKEY(zone)...)
+	}
+	if len(answer) == 0 {
+		answer = append(answer, r.ResolveInView(domain, question.Qtype, view)...)
+	}
+	if len(answer) > 0 {
+		return answer, nil, dns.RcodeSuccess
+	}
+	ns = []dns.RR{r.zoneNegativeSOA(zone)}
+	if isApex || r.nameExists(domain, view) {
+		return answer, ns, dns.RcodeSuccess
+	}
+	return answer, ns, dns.RcodeNameError
+}
+
+// nameExists check if any record can be served for domain,
+// names which are parent of an entry domain exist too as empty non-terminal
+func (r *Resolver) nameExists(domain string, view *models.View) bool {
+	domain = strings.ToLower(domain)
+	for _, e := range r.entries {
+		entryDomain := strings.ToLower(e.Domain)
+		if entryDomain == domain || strings.HasSuffix(entryDomain, "."+domain) {
+			return true
+		}
+	}
+	if IsReverseName(domain) {
+		return len(r.resolvePTR(domain, view)) > 0
+	}
+	if service, proto, baseDomain := splitSRVName(domain); service != "" {
+		entry := r.entryForName(baseDomain)
+		return entry != nil && len(entry.SRVRecordsFor(service, proto)) > 0
+	}
+	return len(view.FilterDevices(r.entryForName(domain), r.ResolveDevices(domain))) > 0
+}
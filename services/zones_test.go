@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestResolveInZone(t *testing.T) {
+	r := newTestResolver(t, `
+netdisco: {endpoint: http://netdisco}
+dns_server:
+  zones:
+  - name: example
+    ns: [ns1.example]
+  - name: 10.in-addr.arpa
+    ns: [ns1.example]
+entries:
+- domain: All.DC1.Example.
+  ttl: 5m
+  targets: [{q: '%'}]
+`)
+	tests := []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		answers int
+	}{
+		{"all.dc1.example.", dns.TypeA, dns.RcodeSuccess, 2},
+		{"ALL.DC1.Example.", dns.TypeAAAA, dns.RcodeSuccess, 1},
+		{"sw1.all.dc1.example.", dns.TypeA, dns.RcodeSuccess, 1},
+		// nodata: name exists without record of this type
+		{"sw1.all.dc1.example.", dns.TypeAAAA, dns.RcodeSuccess, 0},
+		{"all.dc1.example.", dns.TypeMX, dns.RcodeSuccess, 0},
+		// empty non-terminal and apex exist
+		{"dc1.example.", dns.TypeA, dns.RcodeSuccess, 0},
+		{"example.", dns.TypeA, dns.RcodeSuccess, 0},
+		{"example.", dns.TypeSOA, dns.RcodeSuccess, 1},
+		{"example.", dns.TypeNS, dns.RcodeSuccess, 1},
+		// nxdomain
+		{"unknown.example.", dns.TypeA, dns.RcodeNameError, 0},
+		{"sw4.all.dc1.example.", dns.TypeA, dns.RcodeNameError, 0},
+		{"1.0.0.10.in-addr.arpa.", dns.TypePTR, dns.RcodeSuccess, 1},
+		{"1.0.0.10.in-addr.arpa.", dns.TypeA, dns.RcodeSuccess, 0},
+		{"9.0.0.10.in-addr.arpa.", dns.TypePTR, dns.RcodeNameError, 0},
+	}
+	for _, test := range tests {
+		zone := r.findZone(test.name)
+		if zone == nil {
+			t.Fatalf("no zone found for %s", test.name)
+		}
+		answer, ns, rcode := r.resolveInZone(zone, dns.Question{Name: test.name, Qtype: test.qtype, Qclass: dns.ClassINET}, nil)
+		if rcode != test.rcode || len(answer) != test.answers {
+			t.Errorf("%s %s: got rcode %s with %d answers, want %s with %d answers", test.name, dns.TypeToString[test.qtype],
+				dns.RcodeToString[rcode], len(answer), dns.RcodeToString[test.rcode], test.answers)
+		}
+		// negative answers have soa in authority section for negative caching
+		if len(answer) == 0 && (len(ns) != 1 || ns[0].Header().Rrtype != dns.TypeSOA) {
+			t.Errorf("%s %s: negative answer without soa in authority", test.name, dns.TypeToString[test.qtype])
+		}
+		// forward and reverse records have ttl of entry
+		for _, rr := range answer {
+			if rr.Header().Rrtype != dns.TypeSOA && rr.Header().Rrtype != dns.TypeNS && rr.Header().Ttl != 300 {
+				t.Errorf("%s %s: record has not ttl of entry: %s", test.name, dns.TypeToString[test.qtype], rr)
+			}
+		}
+	}
+}